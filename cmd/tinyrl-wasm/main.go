@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"syscall/js"
 
@@ -28,6 +30,7 @@ func registerCallbacks() {
 		js.Global().Set("tinyrlRegisterSnapshotHandler", js.FuncOf(registerSnapshotHandler))
 		js.Global().Set("tinyrlStartTraining", js.FuncOf(startTraining))
 		js.Global().Set("tinyrlStopTraining", js.FuncOf(stopTraining))
+		js.Global().Set("tinyrlLoadCheckpoint", js.FuncOf(loadCheckpoint))
 	})
 }
 
@@ -55,7 +58,65 @@ func startTraining(this js.Value, args []js.Value) interface{} {
 		fmt.Println("snapshot handler not registered")
 		return nil
 	}
+	trainer, err := engine.NewTrainerStrict(cfg)
+	if err != nil {
+		return validationErrorToJS(err)
+	}
+	runTrainer(trainer)
+	return nil
+}
+
+// validationErrorToJS describes a rejected config to the page: the whole message plus one entry per
+// invalid field, so the form can point at the offending controls.
+func validationErrorToJS(err error) js.Value {
+	fields := []interface{}{}
+	var validation *engine.ValidationError
+	if errors.As(err, &validation) {
+		for _, field := range validation.Fields {
+			fields = append(fields, map[string]interface{}{
+				"field":  field.Field,
+				"reason": field.Reason,
+				"value":  fmt.Sprint(field.Value),
+			})
+		}
+	}
+	return js.ValueOf(map[string]interface{}{
+		"error":  err.Error(),
+		"fields": fields,
+	})
+}
+
+// loadCheckpoint resumes training from a checkpoint JSON string written by `tinyrl train --save`.
+// An optional second argument sets how many further episodes to run. Like startTraining it returns an
+// {error, fields} object when the checkpoint or its config is rejected.
+func loadCheckpoint(this js.Value, args []js.Value) interface{} {
+	if len(args) == 0 {
+		fmt.Println("loadCheckpoint requires a checkpoint JSON string")
+		return nil
+	}
+	checkpoint, err := engine.ReadCheckpoint(strings.NewReader(args[0].String()))
+	if err != nil {
+		return validationErrorToJS(fmt.Errorf("invalid checkpoint: %w", err))
+	}
+	if len(args) > 1 && args[1].Type() == js.TypeNumber {
+		checkpoint.Config.Episodes = args[1].Int()
+	}
+	if onSnapshot.IsUndefined() || onSnapshot.IsNull() {
+		fmt.Println("snapshot handler not registered")
+		return nil
+	}
+	if err := checkpoint.Config.Validate(); err != nil {
+		return validationErrorToJS(fmt.Errorf("checkpoint: %w", err))
+	}
+	trainer, err := engine.NewTrainerFromCheckpoint(checkpoint)
+	if err != nil {
+		return validationErrorToJS(fmt.Errorf("load checkpoint: %w", err))
+	}
+	runTrainer(trainer)
+	return nil
+}
 
+func runTrainer(trainer *engine.Trainer) {
 	trainerMu.Lock()
 	if currentCtx != nil {
 		currentCtx()
@@ -64,14 +125,12 @@ func startTraining(this js.Value, args []js.Value) interface{} {
 	currentCtx = cancel
 	trainerMu.Unlock()
 
-	trainer := engine.NewTrainer(cfg)
 	go func() {
 		for snapshot := range trainer.Run(ctx) {
 			payload := snapshotToJS(snapshot)
 			onSnapshot.Invoke(payload)
 		}
 	}()
-	return nil
 }
 
 func stopTraining(this js.Value, args []js.Value) interface{} {
@@ -85,6 +144,9 @@ func stopTraining(this js.Value, args []js.Value) interface{} {
 }
 
 func snapshotToJS(snapshot engine.Snapshot) js.Value {
+	if snapshot.Status == engine.StatusStep {
+		return stepEventToJS(snapshot)
+	}
 	valueMap := make([]interface{}, len(snapshot.ValueMap))
 	for i, row := range snapshot.ValueMap {
 		rowCopy := make([]interface{}, len(row))
@@ -121,21 +183,31 @@ func snapshotToJS(snapshot engine.Snapshot) js.Value {
 		}
 	}
 	config := map[string]interface{}{
-		"episodes":     snapshot.Config.Episodes,
-		"seed":         snapshot.Config.Seed,
-		"epsilon":      snapshot.Config.Epsilon,
-		"alpha":        snapshot.Config.Alpha,
-		"gamma":        snapshot.Config.Gamma,
-		"rows":         snapshot.Config.Rows,
-		"cols":         snapshot.Config.Cols,
-		"stepDelayMs":  snapshot.Config.StepDelayMs,
-		"algorithm":    snapshot.Config.Algorithm,
-		"goals":        goals,
-		"stepPenalty":  snapshot.Config.StepPenalty,
-		"goalCount":    snapshot.Config.GoalCount,
-		"goalInterval": snapshot.Config.GoalInterval,
-		"walls":        walls,
-		"slips":        slips,
+		"episodes":            snapshot.Config.Episodes,
+		"seed":                snapshot.Config.Seed,
+		"epsilon":             snapshot.Config.Epsilon,
+		"exploration":         snapshot.Config.Exploration,
+		"ucbConstant":         snapshot.Config.UCBConstant,
+		"countBonus":          snapshot.Config.CountBonus,
+		"epsilonSchedule":     snapshot.Config.EpsilonSchedule.String(),
+		"alphaSchedule":       snapshot.Config.AlphaSchedule.String(),
+		"temperatureSchedule": snapshot.Config.TemperatureSchedule.String(),
+		"alpha":               snapshot.Config.Alpha,
+		"gamma":               snapshot.Config.Gamma,
+		"rows":                snapshot.Config.Rows,
+		"cols":                snapshot.Config.Cols,
+		"stepDelayMs":         snapshot.Config.StepDelayMs,
+		"algorithm":           snapshot.Config.Algorithm,
+		"goals":               goals,
+		"stepPenalty":         snapshot.Config.StepPenalty,
+		"goalCount":           snapshot.Config.GoalCount,
+		"goalInterval":        snapshot.Config.GoalInterval,
+		"walls":               walls,
+		"slips":               slips,
+		"evalEvery":           snapshot.Config.EvalEvery,
+		"evalEpisodes":        snapshot.Config.EvalEpisodes,
+		"shaping":             snapshot.Config.Shaping,
+		"shapingScale":        snapshot.Config.ShapingScale,
 	}
 	payload := map[string]interface{}{
 		"step":              snapshot.Step,
@@ -154,6 +226,85 @@ func snapshotToJS(snapshot engine.Snapshot) js.Value {
 		"totalSteps":        snapshot.TotalSteps,
 		"config":            config,
 		"status":            snapshot.Status,
+		"shaping":           snapshot.Shaping,
+		"episodeShaping":    snapshot.EpisodeShaping,
+		"epsilon":           snapshot.Epsilon,
+		"alpha":             snapshot.Alpha,
+		"temperature":       snapshot.Temperature,
+	}
+	if len(snapshot.Agents) > 0 {
+		payload["agents"] = positionsToJS(snapshot.Agents)
+		payload["switches"] = positionsToJS(snapshot.Switches)
+		payload["doorOpen"] = snapshot.DoorOpen
+	}
+	if snapshot.Door != nil {
+		payload["door"] = map[string]interface{}{
+			"row": snapshot.Door.Row,
+			"col": snapshot.Door.Col,
+		}
+	}
+	if snapshot.Evaluation != nil {
+		payload["evaluation"] = map[string]interface{}{
+			"episodes":    snapshot.Evaluation.Episodes,
+			"meanReturn":  snapshot.Evaluation.MeanReturn,
+			"returnCI":    snapshot.Evaluation.ReturnCI,
+			"meanSteps":   snapshot.Evaluation.MeanSteps,
+			"stepsCI":     snapshot.Evaluation.StepsCI,
+			"successRate": snapshot.Evaluation.SuccessRate,
+			"successCI":   snapshot.Evaluation.SuccessCI,
+		}
+	}
+	if len(snapshot.Visits) > 0 {
+		visits := make([]interface{}, len(snapshot.Visits))
+		for r, row := range snapshot.Visits {
+			cells := make([]interface{}, len(row))
+			for c, count := range row {
+				cells[c] = count
+			}
+			visits[r] = cells
+		}
+		payload["visits"] = visits
+	}
+	if snapshot.ValueError != nil {
+		payload["valueError"] = map[string]interface{}{
+			"rmse":            snapshot.ValueError.RMSE,
+			"maxError":        snapshot.ValueError.MaxError,
+			"policyAgreement": snapshot.ValueError.PolicyAgreement,
+		}
 	}
 	return js.ValueOf(payload)
 }
+
+// stepEventToJS converts a lightweight step event; the page keeps the last full snapshot for everything else.
+func stepEventToJS(snapshot engine.Snapshot) js.Value {
+	payload := map[string]interface{}{
+		"step":          snapshot.Step,
+		"episode":       snapshot.Episode,
+		"episodeSteps":  snapshot.EpisodeSteps,
+		"episodeReward": snapshot.EpisodeReward,
+		"reward":        snapshot.Reward,
+		"position": map[string]interface{}{
+			"row": snapshot.Position.Row,
+			"col": snapshot.Position.Col,
+		},
+		"status":      snapshot.Status,
+		"epsilon":     snapshot.Epsilon,
+		"alpha":       snapshot.Alpha,
+		"temperature": snapshot.Temperature,
+	}
+	if len(snapshot.Agents) > 0 {
+		payload["agents"] = positionsToJS(snapshot.Agents)
+	}
+	return js.ValueOf(payload)
+}
+
+func positionsToJS(positions []engine.Position) []interface{} {
+	out := make([]interface{}, len(positions))
+	for i, pos := range positions {
+		out[i] = map[string]interface{}{
+			"row": pos.Row,
+			"col": pos.Col,
+		}
+	}
+	return out
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/csv"
 	"encoding/json"
@@ -8,6 +9,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"runtime"
 	"runtime/pprof"
 	"strconv"
 	"strings"
@@ -24,13 +26,19 @@ func main() {
 
 func run() error {
 	if len(os.Args) < 2 {
-		return errors.New("missing subcommand; try 'train'")
+		return errors.New("missing subcommand; try 'train', 'eval', 'sweep' or 'solve'")
 	}
 
 	subcommand := os.Args[1]
 	switch subcommand {
 	case "train":
 		return runTrain(os.Args[2:])
+	case "eval":
+		return runEval(os.Args[2:])
+	case "sweep":
+		return runSweep(os.Args[2:])
+	case "solve":
+		return runSolve(os.Args[2:])
 	default:
 		return fmt.Errorf("unknown subcommand %q", subcommand)
 	}
@@ -40,108 +48,157 @@ func runTrain(args []string) error {
 	fs := flag.NewFlagSet("train", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 
-	envName := fs.String("env", "gridworld", "environment to train in")
-	episodes := fs.Int("episodes", 1, "number of training episodes")
-	seed := fs.Int64("seed", 0, "deterministic seed (0 for default)")
-	epsilon := fs.Float64("epsilon", 0.5, "exploration rate (0-1)")
-	epsilonMin := fs.Float64("epsilon-min", 0.05, "minimum exploration rate")
-	epsilonDecay := fs.Float64("epsilon-decay", 0.998, "per-episode decay multiplier")
-	alpha := fs.Float64("alpha", 0.2, "learning rate (0-1)")
-	gamma := fs.Float64("gamma", 0.9, "discount factor (0-1)")
-	rows := fs.Int("rows", 4, "grid rows")
-	cols := fs.Int("cols", 4, "grid columns")
-	stepDelay := fs.Int("step-delay", 0, "per-step delay in milliseconds")
-	maxSteps := fs.Int("max-steps", 0, "maximum steps per episode (0 uses default)")
-	algorithm := fs.String("algorithm", engine.AlgorithmMonteCarlo, "training algorithm (montecarlo, q-learning, sarsa)")
+	var cfg engine.Config
+	configPath := fs.String("config", "", "read the run configuration from a JSON file (a bare config, or a --run-json summary, which also resumes from the checkpoint that run loaded); flags on the command line override its values")
+	fs.StringVar(&cfg.Env, "env", engine.EnvGridworld, "environment to train in (gridworld, coop)")
+	fs.IntVar(&cfg.Episodes, "episodes", 1, "number of training episodes")
+	fs.Int64Var(&cfg.Seed, "seed", 0, "deterministic seed (0 for default)")
+	fs.Float64Var(&cfg.Epsilon, "epsilon", 0.5, "exploration rate (0-1)")
+	fs.Float64Var(&cfg.EpsilonMin, "epsilon-min", 0.05, "minimum exploration rate")
+	fs.Float64Var(&cfg.EpsilonDecay, "epsilon-decay", 0.998, "per-episode decay multiplier")
+	fs.Float64Var(&cfg.Alpha, "alpha", 0.2, "learning rate (0-1)")
+	fs.Func("epsilon-schedule", "epsilon schedule kind[,final=F][,decay=D][,episodes=N] with kind constant, linear, exponential, step, cosine or inverse (default: --epsilon-decay towards --epsilon-min)", scheduleFlag(&cfg.EpsilonSchedule))
+	fs.Func("alpha-schedule", "alpha schedule like --epsilon-schedule; inverse divides alpha by the visit count of the updated state-action pair (default constant)", scheduleFlag(&cfg.AlphaSchedule))
+	fs.Func("temperature-schedule", "softmax temperature schedule like --epsilon-schedule (default: --softmax-decay towards --softmax-min-temp)", scheduleFlag(&cfg.TemperatureSchedule))
+	fs.Float64Var(&cfg.Gamma, "gamma", 0.9, "discount factor (0-1)")
+	fs.IntVar(&cfg.Rows, "rows", 0, "grid rows (0 uses the environment's default size)")
+	fs.IntVar(&cfg.Cols, "cols", 0, "grid columns (0 uses the environment's default size)")
+	fs.IntVar(&cfg.StepDelayMs, "step-delay", 0, "per-step delay in milliseconds")
+	fs.IntVar(&cfg.MaxSteps, "max-steps", 0, "maximum steps per episode (0 uses default)")
+	fs.StringVar(&cfg.Algorithm, "algorithm", "", "training algorithm: montecarlo, montecarlo-off-policy, q-learning, double-q, dyna-q, dyna-q-plus, sarsa, expected-sarsa, sarsa-lambda, q-lambda, n-step-sarsa or tree-backup (default montecarlo, q-learning with --env coop)")
+	fs.BoolVar(&cfg.EveryVisit, "every-visit", false, "on-policy montecarlo updates every occurrence of a state-action pair, not just the first")
+	fs.StringVar(&cfg.ImportanceSampling, "importance-sampling", engine.ImportanceWeighted, "montecarlo-off-policy estimator: weighted or ordinary")
 	var goals goalListFlag
 	fs.Func("goal", "goal specification row,col,reward (repeatable)", goals.Set)
-	stepPenalty := fs.Float64("step-penalty", 0.02, "per-step penalty (non-negative)")
-	randomStart := fs.Bool("random-start", false, "randomize start position each episode")
-	dumpTrajectory := fs.Bool("dump-trajectory", false, "print first Monte Carlo episode trajectory")
-	goalCount := fs.Int("goal-count", 0, "number of auto-placed goals (0 keeps manual goals)")
-	goalInterval := fs.Int("goal-interval", 20, "episodes before reshuffling auto goals (0 keeps layout)")
+	fs.Float64Var(&cfg.StepPenalty, "step-penalty", 0.02, "per-step penalty (non-negative)")
+	fs.BoolVar(&cfg.RandomStart, "random-start", false, "randomize start position each episode")
+	fs.BoolVar(&cfg.DumpTrajectory, "dump-trajectory", false, "print first Monte Carlo episode trajectory")
+	fs.IntVar(&cfg.GoalCount, "goal-count", 0, "number of auto-placed goals (0 keeps manual goals)")
+	fs.IntVar(&cfg.GoalInterval, "goal-interval", 20, "episodes before reshuffling auto goals (0 keeps layout)")
+	fs.BoolVar(&cfg.GoalAwareState, "goal-aware-state", false, "include collected goals (first 8) in the agent's state on multi-goal boards")
 	var wallPositions positionListFlag
 	fs.Func("wall", "wall tile at row,col (repeatable)", wallPositions.Set)
 	var slipTiles slipListFlag
 	fs.Func("slip", "slip tile row,col,probability (repeatable)", slipTiles.Set)
-	softmaxTemp := fs.Float64("softmax-temp", 1.0, "initial softmax temperature for Monte Carlo policy")
-	softmaxMinTemp := fs.Float64("softmax-min-temp", 0.1, "minimum softmax temperature during an episode")
-	lambda := fs.Float64("lambda", 0.9, "eligibility trace decay (0-1)")
-	warmupEpisodes := fs.Int("warmup-episodes", 0, "episodes using warmup step penalty (0 disables)")
-	warmupPenalty := fs.Float64("warmup-step-penalty", 0, "step penalty during warmup episodes")
+	fs.IntVar(&cfg.WallSwitchEpisode, "wall-switch-episode", 0, "episode at which walls are replaced by --switched-wall tiles (0 disables)")
+	var switchedWalls positionListFlag
+	fs.Func("switched-wall", "wall tile at row,col after the wall switch (repeatable)", switchedWalls.Set)
+	fs.StringVar(&cfg.Exploration, "exploration", engine.ExplorationEpsilonGreedy, "exploration strategy: epsilon-greedy, softmax (Boltzmann over Q) or ucb (UCB1 over visit counts)")
+	fs.Float64Var(&cfg.SoftmaxTemperature, "softmax-temp", 1.0, "initial Boltzmann temperature for --exploration softmax")
+	fs.Float64Var(&cfg.SoftmaxMinTemperature, "softmax-min-temp", 0.1, "temperature floor for --softmax-decay")
+	fs.Float64Var(&cfg.SoftmaxDecay, "softmax-decay", 0.998, "per-episode temperature decay multiplier (0 keeps it constant)")
+	fs.Float64Var(&cfg.UCBConstant, "ucb-c", 1, "confidence bound weight c for --exploration ucb")
+	fs.Float64Var(&cfg.CountBonus, "count-bonus", 0, "MBIE-EB bonus β/√n(s,a) added to learning targets (0 disables)")
+	fs.Float64Var(&cfg.Lambda, "lambda", 0.9, "eligibility trace decay (0-1)")
+	fs.IntVar(&cfg.NSteps, "n-steps", 4, "rewards n-step-sarsa and tree-backup sum before bootstrapping")
+	fs.IntVar(&cfg.PlanningSteps, "planning-steps", 5, "simulated model backups per real step for dyna-q")
+	fs.Float64Var(&cfg.DynaKappa, "dyna-kappa", 0.001, "dyna-q-plus exploration bonus scale")
+	fs.BoolVar(&cfg.ReplacingTraces, "replacing-traces", false, "use replacing instead of accumulating eligibility traces")
+	fs.IntVar(&cfg.WarmupEpisodes, "warmup-episodes", 0, "episodes using warmup step penalty (0 disables)")
+	fs.Float64Var(&cfg.WarmupStepPenalty, "warmup-step-penalty", 0, "step penalty during warmup episodes")
+	fs.BoolVar(&cfg.TrackValueError, "track-optimal", false, "report RMS/max error and policy agreement against the exact optimal Q*")
+	fs.StringVar(&cfg.Shaping, "shaping", engine.ShapingDistance, "reward shaping: distance, potential (policy-invariant γΦ(s')−Φ(s)) or none")
+	fs.Float64Var(&cfg.ShapingScale, "shaping-scale", 0.1, "shaping weight per cell of distance to the nearest goal")
+	fs.IntVar(&cfg.EvalEvery, "eval-every", 0, "run greedy evaluation episodes after every N training episodes (0 disables)")
+	fs.IntVar(&cfg.EvalEpisodes, "eval-episodes", 10, "greedy episodes per periodic evaluation")
 	metricsCSV := fs.String("metrics-csv", "", "write per-episode metrics to CSV at path")
 	runJSON := fs.String("run-json", "", "write final run summary as JSON at path")
+	savePath := fs.String("save", "", "write a checkpoint of the trained Q-tables to path")
+	loadPath := fs.String("load", "", "resume from a checkpoint; its config replaces the board and algorithm flags and --episodes adds episodes")
+	seeds := fs.Int("seeds", 1, "train this many consecutive seeds from --seed concurrently and aggregate learning curves")
+	workers := fs.Int("workers", runtime.NumCPU(), "parallel training runs when --seeds > 1")
+	curveCSV := fs.String("curve-csv", "", "write per-episode mean, standard error and 95% CI across seeds to CSV at path")
+	showVisits := fs.Bool("show-visits", false, "print each episode's cell visit counts as a heatmap")
+	logLevel := fs.String("log-level", "info", "engine log messages to print on stderr: debug, info, warn or error")
 	pprofCPU := fs.String("pprof-cpu", "", "write CPU profile to the given path")
 	pprofHeap := fs.String("pprof-heap", "", "write heap profile to the given path at exit")
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
-
-	if *episodes <= 0 {
-		return fmt.Errorf("episodes must be positive (got %d)", *episodes)
-	}
-	if *epsilon < 0 || *epsilon > 1 {
-		return fmt.Errorf("epsilon must be between 0 and 1 (got %.2f)", *epsilon)
-	}
-	if *epsilonMin < 0 || *epsilonMin > *epsilon {
-		return fmt.Errorf("epsilon-min must be between 0 and epsilon (got %.2f)", *epsilonMin)
-	}
-	if *epsilonDecay < 0 {
-		return fmt.Errorf("epsilon-decay must be non-negative (got %.2f)", *epsilonDecay)
-	}
-	if *alpha < 0 || *alpha > 1 {
-		return fmt.Errorf("alpha must be between 0 and 1 (got %.2f)", *alpha)
-	}
-	if *rows <= 0 {
-		return fmt.Errorf("rows must be positive (got %d)", *rows)
-	}
-	if *cols <= 0 {
-		return fmt.Errorf("cols must be positive (got %d)", *cols)
-	}
-	if *stepDelay < 0 {
-		return fmt.Errorf("step-delay must be non-negative (got %d)", *stepDelay)
-	}
-	if *maxSteps < 0 {
-		return fmt.Errorf("max-steps must be non-negative (got %d)", *maxSteps)
-	}
-	if *algorithm != engine.AlgorithmMonteCarlo {
-		if *algorithm != engine.AlgorithmQLearning && *algorithm != engine.AlgorithmSARSA {
-			return fmt.Errorf("unsupported algorithm %q", *algorithm)
+	if *configPath != "" {
+		// The file replaces the flag defaults, then parsing again puts the flags given on the command
+		// line back on top of it.
+		// A summary of a resumed run names its checkpoint, so the run resumes from it again unless
+		// --load picks another one.
+		load, err := readConfigFile(*configPath, &cfg)
+		if err != nil {
+			return err
+		}
+		if *loadPath == "" {
+			*loadPath = load
+		}
+		goals, wallPositions, slipTiles, switchedWalls = goalListFlag{}, positionListFlag{}, slipListFlag{}, positionListFlag{}
+		if err := fs.Parse(args); err != nil {
+			return err
 		}
 	}
-	if *gamma < 0 || *gamma > 1 {
-		return fmt.Errorf("gamma must be between 0 and 1 (got %.2f)", *gamma)
-	}
-	if *stepPenalty < 0 {
-		return fmt.Errorf("step-penalty must be non-negative (got %.4f)", *stepPenalty)
-	}
-	if *goalCount < 0 {
-		return fmt.Errorf("goal-count must be non-negative (got %d)", *goalCount)
-	}
-	if *goalInterval < 0 {
-		return fmt.Errorf("goal-interval must be non-negative (got %d)", *goalInterval)
-	}
-	if *softmaxTemp <= 0 {
-		return fmt.Errorf("softmax-temp must be positive (got %.2f)", *softmaxTemp)
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "goal":
+			cfg.Goals = goals.Goals
+		case "wall":
+			cfg.Walls = wallPositions.Positions
+		case "slip":
+			cfg.Slips = slipTiles.Slips
+		case "switched-wall":
+			cfg.SwitchedWalls = switchedWalls.Positions
+		}
+	})
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = engine.AlgorithmMonteCarlo
+		if cfg.Env == engine.EnvCoop {
+			cfg.Algorithm = engine.AlgorithmQLearning
+		}
 	}
-	if *softmaxMinTemp < 0 {
-		return fmt.Errorf("softmax-min-temp must be non-negative (got %.2f)", *softmaxMinTemp)
+	// The CLI only reports whole episodes, so running snapshots would be built for nothing.
+	cfg.SnapshotPolicy = engine.SnapshotEpisodeEnd
+
+	minLevel, err := engine.ParseLogLevel(*logLevel)
+	if err != nil {
+		return err
 	}
-	if *softmaxMinTemp > *softmaxTemp {
-		return fmt.Errorf("softmax-min-temp must be <= softmax-temp")
+	if *seeds <= 0 {
+		return fmt.Errorf("seeds must be positive (got %d)", *seeds)
 	}
-	if *lambda < 0 || *lambda > 1 {
-		return fmt.Errorf("lambda must be between 0 and 1 (got %.2f)", *lambda)
+	if *workers <= 0 {
+		return fmt.Errorf("workers must be positive (got %d)", *workers)
 	}
-	if *warmupEpisodes < 0 {
-		return fmt.Errorf("warmup-episodes must be non-negative (got %d)", *warmupEpisodes)
+	multiSeed := *seeds > 1 || *curveCSV != ""
+	if multiSeed && (*metricsCSV != "" || *runJSON != "" || *savePath != "" || *loadPath != "") {
+		return errors.New("--seeds and --curve-csv aggregate runs; they cannot be combined with --metrics-csv, --run-json, --save or --load")
 	}
-	if *warmupPenalty < 0 {
-		return fmt.Errorf("warmup-step-penalty must be non-negative (got %.4f)", *warmupPenalty)
+
+	// A resumed run keeps the checkpoint's board and algorithm; the run length, evaluation and tracking
+	// flags still apply, so everything below follows the config the trainer actually gets.
+	var checkpoint *engine.Checkpoint
+	if *loadPath != "" {
+		loaded, err := readCheckpointFile(*loadPath)
+		if err != nil {
+			return err
+		}
+		loaded.Config.Episodes = cfg.Episodes
+		loaded.Config.SnapshotPolicy = engine.SnapshotEpisodeEnd
+		loaded.Config.EvalEvery = cfg.EvalEvery
+		loaded.Config.EvalEpisodes = cfg.EvalEpisodes
+		loaded.Config.TrackValueError = cfg.TrackValueError
+		checkpoint, cfg = loaded, loaded.Config
+	}
+	fillBoardSize(&cfg)
+	// A checkpoint's own settings may rely on engine defaults; only the run length and evaluation size
+	// come from this command line then.
+	explicit := []flagSetting{{"episodes", float64(cfg.Episodes)}, {"evalEpisodes", float64(cfg.EvalEpisodes)}}
+	if checkpoint == nil {
+		explicit = append(explicit, flagSetting{"softmaxTemperature", cfg.SoftmaxTemperature}, flagSetting{"shapingScale", cfg.ShapingScale})
+	}
+	if err := validateFlags(cfg.Validate(), explicit...); err != nil {
+		if checkpoint != nil {
+			return fmt.Errorf("checkpoint %s: %w", *loadPath, err)
+		}
+		return err
 	}
 
-	effectivePenalty := engine.ScaledStepPenalty(*rows, *cols, *stepPenalty)
+	effectivePenalty := engine.ScaledStepPenalty(cfg.Rows, cfg.Cols, cfg.StepPenalty)
 
 	var (
 		metricsFile   *os.File
@@ -154,7 +211,13 @@ func runTrain(args []string) error {
 		}
 		metricsFile = file
 		metricsWriter = csv.NewWriter(file)
-		header := []string{"episode", "steps", "episode_reward", "success", "epsilon", "alpha", "gamma", "rows", "cols", "step_penalty", "algorithm", "seed", "goal_count", "goal_interval"}
+		header := []string{"episode", "steps", "episode_reward", "success", "epsilon", "alpha", "gamma", "rows", "cols", "step_penalty", "algorithm", "seed", "goal_count", "goal_interval", "episode_shaping", "temperature"}
+		if cfg.TrackValueError {
+			header = append(header, "value_rmse", "value_max_error", "policy_agreement")
+		}
+		if cfg.EvalEvery > 0 {
+			header = append(header, "eval_mean_return", "eval_return_ci95", "eval_mean_steps", "eval_success_rate", "eval_success_ci95")
+		}
 		if err := metricsWriter.Write(header); err != nil {
 			metricsWriter.Flush()
 			metricsFile.Close()
@@ -214,54 +277,65 @@ func runTrain(args []string) error {
 		}()
 	}
 
-	fmt.Printf("train config => env=%s episodes=%d seed=%d epsilon=%.2f epsilonMin=%.2f epsilonDecay=%.3f alpha=%.2f gamma=%.2f lambda=%.2f rows=%d cols=%d stepDelayMs=%d maxSteps=%d stepPenalty=%.3f warmupEpisodes=%d warmupPenalty=%.3f effectiveStepPenalty=%.3f goalCount=%d goalInterval=%d softmaxTemp=%.2f softmaxMinTemp=%.2f randomStart=%t dumpTrajectory=%t algorithm=%s\n", *envName, *episodes, *seed, *epsilon, *epsilonMin, *epsilonDecay, *alpha, *gamma, *lambda, *rows, *cols, *stepDelay, *maxSteps, *stepPenalty, *warmupEpisodes, *warmupPenalty, effectivePenalty, *goalCount, *goalInterval, *softmaxTemp, *softmaxMinTemp, *randomStart, *dumpTrajectory, *algorithm)
+	fmt.Printf("train config => env=%s episodes=%d seed=%d epsilon=%.2f epsilonMin=%.2f epsilonDecay=%.3f alpha=%.2f gamma=%.2f lambda=%.2f nSteps=%d replacingTraces=%t planningSteps=%d dynaKappa=%.4f rows=%d cols=%d stepDelayMs=%d maxSteps=%d stepPenalty=%.3f warmupEpisodes=%d warmupPenalty=%.3f effectiveStepPenalty=%.3f goalCount=%d goalInterval=%d goalAwareState=%t exploration=%s softmaxTemp=%.2f softmaxMinTemp=%.2f softmaxDecay=%.3f ucbC=%.2f countBonus=%.3f randomStart=%t dumpTrajectory=%t trackOptimal=%t shaping=%s shapingScale=%.3f evalEvery=%d evalEpisodes=%d algorithm=%s everyVisit=%t importanceSampling=%s\n", cfg.Env, cfg.Episodes, cfg.Seed, cfg.Epsilon, cfg.EpsilonMin, cfg.EpsilonDecay, cfg.Alpha, cfg.Gamma, cfg.Lambda, cfg.NSteps, cfg.ReplacingTraces, cfg.PlanningSteps, cfg.DynaKappa, cfg.Rows, cfg.Cols, cfg.StepDelayMs, cfg.MaxSteps, cfg.StepPenalty, cfg.WarmupEpisodes, cfg.WarmupStepPenalty, effectivePenalty, cfg.GoalCount, cfg.GoalInterval, cfg.GoalAwareState, cfg.Exploration, cfg.SoftmaxTemperature, cfg.SoftmaxMinTemperature, cfg.SoftmaxDecay, cfg.UCBConstant, cfg.CountBonus, cfg.RandomStart, cfg.DumpTrajectory, cfg.TrackValueError, cfg.Shaping, cfg.ShapingScale, cfg.EvalEvery, cfg.EvalEpisodes, cfg.Algorithm, cfg.EveryVisit, cfg.ImportanceSampling)
 
-	cfg := engine.Config{
-		Episodes:              *episodes,
-		Seed:                  *seed,
-		Epsilon:               *epsilon,
-		EpsilonMin:            *epsilonMin,
-		EpsilonDecay:          *epsilonDecay,
-		Alpha:                 *alpha,
-		Gamma:                 *gamma,
-		Rows:                  *rows,
-		Cols:                  *cols,
-		StepDelayMs:           *stepDelay,
-		MaxSteps:              *maxSteps,
-		Algorithm:             *algorithm,
-		Goals:                 goals.Goals,
-		StepPenalty:           *stepPenalty,
-		RandomStart:           *randomStart,
-		DumpTrajectory:        *dumpTrajectory,
-		GoalCount:             *goalCount,
-		GoalInterval:          *goalInterval,
-		SoftmaxTemperature:    *softmaxTemp,
-		SoftmaxMinTemperature: *softmaxMinTemp,
-		Lambda:                *lambda,
-		WarmupEpisodes:        *warmupEpisodes,
-		WarmupStepPenalty:     *warmupPenalty,
-		Walls:                 wallPositions.Positions,
-		Slips:                 slipTiles.Slips,
-	}
-	trainer := engine.NewTrainer(cfg)
+	if multiSeed {
+		return runSeedCurves(cfg, *seeds, *workers, *curveCSV)
+	}
+	var trainer *engine.Trainer
+	if checkpoint != nil {
+		trainer, err = engine.NewTrainerFromCheckpoint(checkpoint)
+		if err != nil {
+			return fmt.Errorf("load checkpoint: %w", err)
+		}
+		fmt.Printf("resuming from %s after %d episodes (algorithm=%s)\n", *loadPath, checkpoint.EpisodesCompleted, checkpoint.Config.Algorithm)
+	} else {
+		trainer = engine.NewTrainer(cfg)
+	}
+	trainer.SetLogger(stderrLogger, minLevel)
 	ctx := context.Background()
 	var (
 		cumulativeReward float64
 		cumulativeSteps  int
 		successCount     int
+		completed        int
 		valueMap         [][]float64
+		valueError       *engine.ValueError
 		finalConfig      = cfg
 		lastSuccessCount int
+		// pendingRow holds an episode's metrics until the evaluation that follows it fills the eval columns.
+		pendingRow []string
 	)
+	writeMetricsRow := func(record []string) error {
+		if err := metricsWriter.Write(record); err != nil {
+			return fmt.Errorf("write metrics row: %w", err)
+		}
+		metricsWriter.Flush()
+		if err := metricsWriter.Error(); err != nil {
+			return fmt.Errorf("flush metrics row: %w", err)
+		}
+		return nil
+	}
 	for snapshot := range trainer.Run(ctx) {
+		// Write a held row as it is if no evaluation follows it, rather than losing it.
+		if pendingRow != nil && snapshot.Status != engine.StatusEvaluation {
+			if err := writeMetricsRow(pendingRow); err != nil {
+				return err
+			}
+			pendingRow = nil
+		}
 		switch snapshot.Status {
 		case engine.StatusRunning:
 			// suppress verbose step-level output in CLI mode
 		case engine.StatusEpisodeComplete:
 			fmt.Printf("episode %d: reward=%.2f steps=%d\n", snapshot.Episode, snapshot.EpisodeReward, snapshot.EpisodeSteps)
+			if *showVisits {
+				printVisits(snapshot.Episode, snapshot.Visits)
+			}
 			cumulativeReward = snapshot.TotalReward
 			cumulativeSteps = snapshot.TotalSteps
 			successCount = snapshot.SuccessCount
+			completed = snapshot.EpisodesCompleted
 			valueMap = snapshot.ValueMap
 			finalConfig = snapshot.Config
 			successDelta := 0
@@ -275,8 +349,8 @@ func runTrain(args []string) error {
 					strconv.Itoa(snapshot.EpisodeSteps),
 					fmt.Sprintf("%.4f", snapshot.EpisodeReward),
 					strconv.Itoa(successDelta),
-					fmt.Sprintf("%.6f", snapshot.Config.Epsilon),
-					fmt.Sprintf("%.6f", snapshot.Config.Alpha),
+					fmt.Sprintf("%.6f", snapshot.Epsilon),
+					fmt.Sprintf("%.6f", snapshot.Alpha),
 					fmt.Sprintf("%.6f", snapshot.Config.Gamma),
 					strconv.Itoa(snapshot.Config.Rows),
 					strconv.Itoa(snapshot.Config.Cols),
@@ -285,20 +359,42 @@ func runTrain(args []string) error {
 					strconv.FormatInt(snapshot.Config.Seed, 10),
 					strconv.Itoa(snapshot.Config.GoalCount),
 					strconv.Itoa(snapshot.Config.GoalInterval),
+					fmt.Sprintf("%.4f", snapshot.EpisodeShaping),
+					fmt.Sprintf("%.6f", snapshot.Temperature),
+				}
+				if cfg.TrackValueError {
+					record = append(record, valueErrorColumns(snapshot.ValueError)...)
 				}
-				if err := metricsWriter.Write(record); err != nil {
-					return fmt.Errorf("write metrics row: %w", err)
+				if cfg.EvalEvery > 0 {
+					record = append(record, evaluationColumns(nil)...)
+					if snapshot.Episode%cfg.EvalEvery == 0 {
+						pendingRow = record
+						break
+					}
 				}
-				metricsWriter.Flush()
-				if err := metricsWriter.Error(); err != nil {
-					return fmt.Errorf("flush metrics row: %w", err)
+				if err := writeMetricsRow(record); err != nil {
+					return err
 				}
 			}
+		case engine.StatusEvaluation:
+			eval := snapshot.Evaluation
+			fmt.Printf("evaluation after episode %d: mean_return=%.3f±%.3f mean_steps=%.2f±%.2f success_rate=%.3f±%.3f\n",
+				snapshot.Episode, eval.MeanReturn, eval.ReturnCI, eval.MeanSteps, eval.StepsCI, eval.SuccessRate, eval.SuccessCI)
+			if metricsWriter != nil && pendingRow != nil {
+				columns := evaluationColumns(eval)
+				copy(pendingRow[len(pendingRow)-len(columns):], columns)
+				if err := writeMetricsRow(pendingRow); err != nil {
+					return err
+				}
+				pendingRow = nil
+			}
 		case engine.StatusDone:
 			cumulativeReward = snapshot.TotalReward
 			cumulativeSteps = snapshot.TotalSteps
 			successCount = snapshot.SuccessCount
+			completed = snapshot.EpisodesCompleted
 			valueMap = snapshot.ValueMap
+			valueError = snapshot.ValueError
 			finalConfig = snapshot.Config
 		case engine.StatusCancelled:
 			fmt.Println("training cancelled")
@@ -306,21 +402,35 @@ func runTrain(args []string) error {
 		}
 	}
 
-	avgReward := cumulativeReward / float64(*episodes)
-	avgSteps := float64(cumulativeSteps) / float64(*episodes)
-	successRate := float64(successCount) / float64(*episodes)
+	// Totals are cumulative across resumed runs, so average over every completed episode.
+	if completed == 0 {
+		completed = 1
+	}
+	avgReward := cumulativeReward / float64(completed)
+	avgSteps := float64(cumulativeSteps) / float64(completed)
+	successRate := float64(successCount) / float64(completed)
 	fmt.Printf("summary: avg_reward=%.2f avg_steps=%.2f success_rate=%.2f\n", avgReward, avgSteps, successRate)
+	if valueError != nil {
+		fmt.Printf("value error: rmse=%.4f max=%.4f policy_agreement=%.1f%%\n", valueError.RMSE, valueError.MaxError, valueError.PolicyAgreement)
+	}
 	printValueMap(valueMap)
 	if runSummaryEnc != nil {
+		// Config is the configuration as requested and Load the checkpoint a resumed run started from, so
+		// `train --config` on this file repeats the run; FinalConfig is the trainer's normalized view at the
+		// end, with the decayed epsilon.
 		payload := struct {
-			Config  engine.Config `json:"config"`
-			Summary struct {
+			Load        string        `json:"load,omitempty"`
+			Config      engine.Config `json:"config"`
+			FinalConfig engine.Config `json:"final_config"`
+			Summary     struct {
 				AvgReward   float64 `json:"avg_reward"`
 				AvgSteps    float64 `json:"avg_steps"`
 				SuccessRate float64 `json:"success_rate"`
 			} `json:"summary"`
 		}{
-			Config: finalConfig,
+			Load:        *loadPath,
+			Config:      cfg,
+			FinalConfig: finalConfig,
 		}
 		payload.Summary.AvgReward = avgReward
 		payload.Summary.AvgSteps = avgSteps
@@ -330,6 +440,13 @@ func runTrain(args []string) error {
 		}
 	}
 
+	if *savePath != "" {
+		if err := writeCheckpointFile(*savePath, trainer.Checkpoint()); err != nil {
+			return err
+		}
+		fmt.Printf("checkpoint saved to %s\n", *savePath)
+	}
+
 	if *pprofHeap != "" {
 		heapFile, err := os.Create(*pprofHeap)
 		if err != nil {
@@ -347,6 +464,370 @@ func runTrain(args []string) error {
 	return nil
 }
 
+// flagSetting is a config field the command line must set to a positive value.
+type flagSetting struct {
+	field string
+	value float64
+}
+
+// validateFlags adds to a Validate or ValidateEnvironment error the settings that are zero. Zero selects an
+// engine default for them, so on the command line, where every setting is spelled out, it is a mistake.
+func validateFlags(err error, settings ...flagSetting) error {
+	var validation *engine.ValidationError
+	if err != nil && !errors.As(err, &validation) {
+		return err
+	}
+	var fields []*engine.FieldError
+	if validation != nil {
+		fields = validation.Fields
+	}
+	for _, setting := range settings {
+		// Negative values are already reported by Validate.
+		if setting.value == 0 {
+			fields = append(fields, &engine.FieldError{Field: setting.field, Value: setting.value, Reason: "must be positive"})
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return &engine.ValidationError{Fields: fields}
+}
+
+// fillBoardSize gives a zero Rows or Cols the environment's default, so the printed config and the scaled
+// step penalty describe the board that is actually built.
+func fillBoardSize(cfg *engine.Config) {
+	rows, cols := engine.DefaultBoardSize(cfg.Env)
+	if cfg.Rows == 0 {
+		cfg.Rows = rows
+	}
+	if cfg.Cols == 0 {
+		cfg.Cols = cols
+	}
+}
+
+// scheduleFlag parses a --*-schedule flag into target.
+func scheduleFlag(target *engine.Schedule) func(string) error {
+	return func(spec string) error {
+		schedule, err := engine.ParseSchedule(spec)
+		if err != nil {
+			return err
+		}
+		*target = schedule
+		return nil
+	}
+}
+
+// readConfigFile decodes the JSON config at path into cfg; keys the file leaves out keep cfg's values.
+// A --run-json summary is accepted too, in which case its "config" block is used and the checkpoint a
+// resumed run loaded, if any, is returned.
+func readConfigFile(path string, cfg *engine.Config) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read config: %w", err)
+	}
+	var summary struct {
+		Load   string          `json:"load"`
+		Config json.RawMessage `json:"config"`
+	}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return "", fmt.Errorf("decode config %s: %w", path, err)
+	}
+	if summary.Config != nil {
+		data = summary.Config
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return "", fmt.Errorf("decode config %s: %w", path, err)
+	}
+	return summary.Load, nil
+}
+
+func readCheckpointFile(path string) (*engine.Checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open checkpoint: %w", err)
+	}
+	defer file.Close()
+	return engine.ReadCheckpoint(file)
+}
+
+func writeCheckpointFile(path string, checkpoint *engine.Checkpoint) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create checkpoint: %w", err)
+	}
+	if err := engine.WriteCheckpoint(file, checkpoint); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close checkpoint: %w", err)
+	}
+	return nil
+}
+
+func runEval(args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	loadPath := fs.String("load", "", "evaluate the Q-tables in this checkpoint instead of training a fresh agent")
+	episodes := fs.Int("episodes", 100, "number of greedy evaluation episodes")
+	seed := fs.Int64("seed", 1, "seed for evaluation slips and tie-breaking")
+	render := fs.Int("render", 1, "number of evaluation trajectories to draw")
+	envName := fs.String("env", engine.EnvGridworld, "environment for a fresh agent (gridworld, coop)")
+	algorithm := fs.String("algorithm", engine.AlgorithmQLearning, "training algorithm for a fresh agent")
+	trainEpisodes := fs.Int("train-episodes", 500, "training episodes for a fresh agent")
+	trainSeed := fs.Int64("train-seed", 0, "training seed for a fresh agent (0 for default)")
+	epsilon := fs.Float64("epsilon", 0.5, "training exploration rate (0-1)")
+	epsilonMin := fs.Float64("epsilon-min", 0.05, "minimum training exploration rate")
+	epsilonDecay := fs.Float64("epsilon-decay", 0.998, "per-episode decay multiplier")
+	alpha := fs.Float64("alpha", 0.2, "learning rate (0-1)")
+	gamma := fs.Float64("gamma", 0.9, "discount factor (0-1)")
+	rows := fs.Int("rows", 0, "grid rows (0 uses the environment's default size)")
+	cols := fs.Int("cols", 0, "grid columns (0 uses the environment's default size)")
+	maxSteps := fs.Int("max-steps", 0, "maximum steps per episode (0 uses default)")
+	var goals goalListFlag
+	fs.Func("goal", "goal specification row,col,reward (repeatable)", goals.Set)
+	stepPenalty := fs.Float64("step-penalty", 0.02, "per-step penalty (non-negative)")
+	goalAwareState := fs.Bool("goal-aware-state", false, "include collected goals (first 8) in the agent's state on multi-goal boards")
+	var wallPositions positionListFlag
+	fs.Func("wall", "wall tile at row,col (repeatable)", wallPositions.Set)
+	var slipTiles slipListFlag
+	fs.Func("slip", "slip tile row,col,probability (repeatable)", slipTiles.Set)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *episodes <= 0 {
+		return fmt.Errorf("episodes must be positive (got %d)", *episodes)
+	}
+	if *render < 0 {
+		return fmt.Errorf("render must be non-negative (got %d)", *render)
+	}
+
+	var trainer *engine.Trainer
+	if *loadPath != "" {
+		checkpoint, err := readCheckpointFile(*loadPath)
+		if err != nil {
+			return err
+		}
+		if err := checkpoint.Config.Validate(); err != nil {
+			return fmt.Errorf("checkpoint %s: %w", *loadPath, err)
+		}
+		trainer, err = engine.NewTrainerFromCheckpoint(checkpoint)
+		if err != nil {
+			return fmt.Errorf("load checkpoint: %w", err)
+		}
+		fmt.Printf("eval config => checkpoint=%s trainedEpisodes=%d episodes=%d seed=%d\n", *loadPath, checkpoint.EpisodesCompleted, *episodes, *seed)
+	} else {
+		cfg := engine.Config{
+			Env:            *envName,
+			Episodes:       *trainEpisodes,
+			Seed:           *trainSeed,
+			Epsilon:        *epsilon,
+			EpsilonMin:     *epsilonMin,
+			EpsilonDecay:   *epsilonDecay,
+			Alpha:          *alpha,
+			Gamma:          *gamma,
+			Rows:           *rows,
+			Cols:           *cols,
+			MaxSteps:       *maxSteps,
+			Algorithm:      *algorithm,
+			Goals:          goals.Goals,
+			StepPenalty:    *stepPenalty,
+			GoalAwareState: *goalAwareState,
+			Walls:          wallPositions.Positions,
+			Slips:          slipTiles.Slips,
+			SnapshotPolicy: engine.SnapshotEpisodeEnd,
+		}
+		fillBoardSize(&cfg)
+		if err := validateFlags(cfg.Validate(), flagSetting{"episodes", float64(cfg.Episodes)}); err != nil {
+			return err
+		}
+		trainer = engine.NewTrainer(cfg)
+		fmt.Printf("eval config => env=%s algorithm=%s trainEpisodes=%d trainSeed=%d rows=%d cols=%d episodes=%d seed=%d\n", *envName, *algorithm, *trainEpisodes, *trainSeed, cfg.Rows, cfg.Cols, *episodes, *seed)
+		for range trainer.Run(context.Background()) {
+			// train silently; only the greedy rollouts are reported
+		}
+	}
+
+	eval := trainer.Evaluate(*episodes, *seed)
+	fmt.Printf("eval: episodes=%d mean_return=%.3f±%.3f mean_steps=%.2f±%.2f success_rate=%.3f±%.3f (95%% CI)\n",
+		eval.Episodes, eval.MeanReturn, eval.ReturnCI, eval.MeanSteps, eval.StepsCI, eval.SuccessRate, eval.SuccessCI)
+	for i := 0; i < *render && i < len(eval.Runs); i++ {
+		run := eval.Runs[i]
+		fmt.Printf("trajectory %d: return=%.2f steps=%d success=%t\n", i+1, run.Return, run.Steps, run.Success)
+		printTrajectory(eval.Layout, run.Paths)
+	}
+	return nil
+}
+
+// printTrajectory draws greedy paths over the board. A single agent's path is '*' from 'S' to '@';
+// multi-agent paths use the agent's number. Walls are '#', slips '~', goals 'G', switches '_' and the door 'D'.
+func printTrajectory(layout engine.RenderInfo, paths [][]engine.Position) {
+	if layout.Rows <= 0 || layout.Cols <= 0 {
+		return
+	}
+	grid := make([][]byte, layout.Rows)
+	for r := range grid {
+		grid[r] = []byte(strings.Repeat(".", layout.Cols))
+	}
+	set := func(pos engine.Position, mark byte) {
+		if pos.Row >= 0 && pos.Row < layout.Rows && pos.Col >= 0 && pos.Col < layout.Cols {
+			grid[pos.Row][pos.Col] = mark
+		}
+	}
+	for _, slip := range layout.Slips {
+		set(engine.Position{Row: slip.Row, Col: slip.Col}, '~')
+	}
+	for agent, path := range paths {
+		mark := byte('*')
+		if len(paths) > 1 {
+			mark = byte('1' + agent)
+		}
+		for _, pos := range path {
+			set(pos, mark)
+		}
+		if len(paths) == 1 && len(path) > 0 {
+			set(path[len(path)-1], '@')
+			set(path[0], 'S')
+		}
+	}
+	for _, sw := range layout.Switches {
+		set(sw, '_')
+	}
+	if layout.Door != nil {
+		set(*layout.Door, 'D')
+	}
+	for _, wall := range layout.Walls {
+		set(wall, '#')
+	}
+	for _, goal := range layout.Goals {
+		set(engine.Position{Row: goal.Row, Col: goal.Col}, 'G')
+	}
+	for _, row := range grid {
+		for _, cell := range row {
+			fmt.Printf("%2c ", cell)
+		}
+		fmt.Println()
+	}
+}
+
+func runSolve(args []string) error {
+	fs := flag.NewFlagSet("solve", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	method := fs.String("method", engine.SolverValueIteration, "dynamic-programming method (value-iteration, policy-iteration)")
+	shaping := fs.String("shaping", engine.ShapingDistance, "reward shaping folded into the model: distance, potential or none")
+	shapingScale := fs.Float64("shaping-scale", 0.1, "shaping weight per cell of distance to the nearest goal")
+	gamma := fs.Float64("gamma", 0.9, "discount factor (0-1)")
+	rows := fs.Int("rows", 0, "grid rows (0 uses the environment's default size)")
+	cols := fs.Int("cols", 0, "grid columns (0 uses the environment's default size)")
+	var goals goalListFlag
+	fs.Func("goal", "goal specification row,col,reward (repeatable)", goals.Set)
+	stepPenalty := fs.Float64("step-penalty", 0.02, "per-step penalty (non-negative)")
+	goalCount := fs.Int("goal-count", 0, "number of auto-placed goals (0 keeps manual goals)")
+	var wallPositions positionListFlag
+	fs.Func("wall", "wall tile at row,col (repeatable)", wallPositions.Set)
+	var slipTiles slipListFlag
+	fs.Func("slip", "slip tile row,col,probability (repeatable)", slipTiles.Set)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := engine.Config{
+		Gamma:        *gamma,
+		Rows:         *rows,
+		Cols:         *cols,
+		Goals:        goals.Goals,
+		StepPenalty:  *stepPenalty,
+		GoalCount:    *goalCount,
+		Walls:        wallPositions.Positions,
+		Slips:        slipTiles.Slips,
+		Shaping:      *shaping,
+		ShapingScale: *shapingScale,
+	}
+	fillBoardSize(&cfg)
+	if err := validateFlags(cfg.ValidateEnvironment(), flagSetting{"shapingScale", cfg.ShapingScale}); err != nil {
+		return err
+	}
+	fmt.Printf("solve config => method=%s gamma=%.2f rows=%d cols=%d stepPenalty=%.3f goalCount=%d\n", *method, *gamma, cfg.Rows, cfg.Cols, *stepPenalty, *goalCount)
+	solution, err := engine.Solve(cfg, *method)
+	if err != nil {
+		return err
+	}
+	if !solution.Converged {
+		fmt.Fprintf(os.Stderr, "warning: %s did not converge after %d iterations\n", solution.Method, solution.Iterations)
+	}
+	fmt.Printf("%s: iterations=%d\n", solution.Method, solution.Iterations)
+	printValueMap(solution.Values)
+	printPolicy(solution.Policy)
+	return nil
+}
+
+func printPolicy(policy [][]int) {
+	if len(policy) == 0 {
+		return
+	}
+	arrows := []string{"^", ">", "v", "<"}
+	fmt.Println("policy:")
+	for _, row := range policy {
+		for _, action := range row {
+			fmt.Printf("%2s ", arrows[action])
+		}
+		fmt.Println()
+	}
+}
+
+func valueErrorColumns(valueError *engine.ValueError) []string {
+	if valueError == nil {
+		return []string{"", "", ""}
+	}
+	return []string{
+		fmt.Sprintf("%.6f", valueError.RMSE),
+		fmt.Sprintf("%.6f", valueError.MaxError),
+		fmt.Sprintf("%.2f", valueError.PolicyAgreement),
+	}
+}
+
+func evaluationColumns(eval *engine.Evaluation) []string {
+	if eval == nil {
+		return []string{"", "", "", "", ""}
+	}
+	return []string{
+		fmt.Sprintf("%.4f", eval.MeanReturn),
+		fmt.Sprintf("%.4f", eval.ReturnCI),
+		fmt.Sprintf("%.2f", eval.MeanSteps),
+		fmt.Sprintf("%.4f", eval.SuccessRate),
+		fmt.Sprintf("%.4f", eval.SuccessCI),
+	}
+}
+
+// stderrLogger prints engine log messages on stderr so they never mix with CSV or table output.
+var stderrLogger = engine.LoggerFunc(func(level engine.LogLevel, msg string) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", level, msg)
+})
+
+func printVisits(episode int, visits [][]int) {
+	if len(visits) == 0 {
+		return
+	}
+	fmt.Printf("visit heatmap (episode %d)\n", episode)
+	for _, row := range visits {
+		for _, count := range row {
+			if count == 0 {
+				fmt.Printf("  . ")
+			} else {
+				fmt.Printf("%3d ", count)
+			}
+		}
+		fmt.Println()
+	}
+}
+
 func printValueMap(data [][]float64) {
 	if len(data) == 0 {
 		return
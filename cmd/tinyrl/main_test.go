@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"tiny-rl-go/internal/engine"
+)
+
+func TestCoopRunsWithDefaultBoardSize(t *testing.T) {
+	// The coop board needs five columns; leaving --rows and --cols unset must pick a board it can use.
+	if err := runTrain([]string{"--env", "coop", "--episodes", "3"}); err != nil {
+		t.Fatalf("train --env coop: %v", err)
+	}
+	if err := runEval([]string{"--env", "coop"}); err != nil {
+		t.Fatalf("eval --env coop: %v", err)
+	}
+}
+
+func TestCommandLineConfigsFailValidationWithFieldErrors(t *testing.T) {
+	err := runTrain([]string{"--episodes", "0", "--softmax-temp", "0", "--alpha", "2"})
+	var validation *engine.ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	var fields []string
+	for _, field := range validation.Fields {
+		fields = append(fields, field.Field)
+	}
+	if want := []string{"alpha", "episodes", "softmaxTemperature"}; !reflect.DeepEqual(fields, want) {
+		t.Fatalf("expected errors for %v, got %v", want, fields)
+	}
+	if err := runSolve([]string{"--shaping-scale", "0"}); !errors.As(err, &validation) {
+		t.Fatalf("expected solve to reject a zero shaping scale with a ValidationError, got %v", err)
+	}
+
+	// A checkpoint written by a lenient caller is checked before training resumes from it.
+	trainer := engine.NewTrainer(engine.Config{Episodes: 1, Alpha: 0.1, Gamma: 0.9})
+	for range trainer.Run(context.Background()) {
+	}
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := writeCheckpointFile(path, trainer.Checkpoint()); err != nil {
+		t.Fatal(err)
+	}
+	var field *engine.FieldError
+	if err := runTrain([]string{"--load", path}); !errors.As(err, &field) || field.Field != "epsilon" {
+		t.Fatalf("expected the checkpoint's zero epsilon to be rejected, got %v", err)
+	}
+	if err := runEval([]string{"--load", path}); !errors.As(err, &field) || field.Field != "epsilon" {
+		t.Fatalf("expected eval to reject the checkpoint's zero epsilon, got %v", err)
+	}
+}
+
+func TestSweepRejectsInvalidPointsAndSamplesDistinctOnes(t *testing.T) {
+	var field *engine.FieldError
+	if err := runSweep([]string{"--alpha", "0:0.4:0.2", "--episodes", "5", "--seeds", "1"}); !errors.As(err, &field) || field.Field != "alpha" {
+		t.Fatalf("expected the zero alpha point to be rejected, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sweep.json")
+	args := []string{"--alpha", "0.1,0.2", "--gamma", "0.8,0.9", "--random", "4", "--episodes", "5", "--seeds", "1", "--out-json", path}
+	if err := runSweep(args); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []sweepRow
+	if err := json.Unmarshal(data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	seen := map[sweepPoint]bool{}
+	for _, row := range rows {
+		seen[row.sweepPoint] = true
+	}
+	if len(rows) != 4 || len(seen) != 4 {
+		t.Fatalf("expected --random 4 to cover all 4 grid points once, got %d rows with %d distinct points", len(rows), len(seen))
+	}
+}
+
+func TestRunSummaryOfAResumedRunRepeatsIt(t *testing.T) {
+	dir := t.TempDir()
+	checkpoint := filepath.Join(dir, "checkpoint.json")
+	if err := runTrain([]string{"--algorithm", "q-learning", "--episodes", "20", "--save", checkpoint}); err != nil {
+		t.Fatal(err)
+	}
+	first, second := filepath.Join(dir, "first.json"), filepath.Join(dir, "second.json")
+	if err := runTrain([]string{"--load", checkpoint, "--episodes", "10", "--run-json", first}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runTrain([]string{"--config", first, "--run-json", second}); err != nil {
+		t.Fatal(err)
+	}
+	read := func(path string) map[string]any {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var summary map[string]any
+		if err := json.Unmarshal(data, &summary); err != nil {
+			t.Fatal(err)
+		}
+		return summary
+	}
+	original, repeated := read(first), read(second)
+	if original["load"] != checkpoint {
+		t.Fatalf("expected the summary to name the checkpoint %s, got %v", checkpoint, original["load"])
+	}
+	if !reflect.DeepEqual(original, repeated) {
+		t.Fatalf("expected --config on the summary to repeat the resumed run:\n got %v\nwant %v", repeated, original)
+	}
+}
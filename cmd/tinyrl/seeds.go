@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+
+	"tiny-rl-go/internal/engine"
+)
+
+// runSeedCurves trains cfg under several seeds and reports the learning curve across them.
+func runSeedCurves(cfg engine.Config, seeds, workers int, curveCSV string) error {
+	results := engine.TrainSeeds(context.Background(), cfg, seeds, workers)
+	curve := engine.LearningCurve(results)
+
+	rewards := make([]float64, len(results))
+	successes := make([]float64, len(results))
+	for i, result := range results {
+		rewards[i], successes[i] = result.Window(0)
+	}
+	reward := engine.Summarize(rewards)
+	success := engine.Summarize(successes)
+	fmt.Printf("seeds summary: seeds=%d avg_reward=%.3f [%.3f, %.3f] success_rate=%.3f [%.3f, %.3f] (95%% CI)\n",
+		len(results), reward.Mean, reward.Low, reward.High, success.Mean, success.Low, success.High)
+	if len(curve) > 0 {
+		last := curve[len(curve)-1]
+		fmt.Printf("final episode %d: reward=%.3f±%.3f (se) success=%.3f±%.3f (se)\n",
+			last.Episode, last.Reward.Mean, last.Reward.StdErr, last.Success.Mean, last.Success.StdErr)
+	}
+
+	if curveCSV == "" {
+		return nil
+	}
+	file, err := os.Create(curveCSV)
+	if err != nil {
+		return fmt.Errorf("create curve csv: %w", err)
+	}
+	writer := csv.NewWriter(file)
+	header := []string{"episode", "seeds"}
+	for _, name := range []string{"reward", "steps", "success"} {
+		header = append(header, name+"_mean", name+"_se", name+"_ci95_low", name+"_ci95_high")
+	}
+	if err := writer.Write(header); err != nil {
+		file.Close()
+		return fmt.Errorf("write curve header: %w", err)
+	}
+	for _, point := range curve {
+		record := []string{strconv.Itoa(point.Episode), strconv.Itoa(point.Runs)}
+		for _, stat := range []engine.Stat{point.Reward, point.Steps, point.Success} {
+			record = append(record,
+				fmt.Sprintf("%.6f", stat.Mean),
+				fmt.Sprintf("%.6f", stat.StdErr),
+				fmt.Sprintf("%.6f", stat.Low),
+				fmt.Sprintf("%.6f", stat.High),
+			)
+		}
+		if err := writer.Write(record); err != nil {
+			file.Close()
+			return fmt.Errorf("write curve row: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return fmt.Errorf("flush curve csv: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close curve csv: %w", err)
+	}
+	return nil
+}
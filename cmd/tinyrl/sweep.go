@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tiny-rl-go/internal/engine"
+)
+
+// sweepPoint is one hyperparameter combination of a sweep.
+type sweepPoint struct {
+	Algorithm    string  `json:"algorithm"`
+	Alpha        float64 `json:"alpha"`
+	Gamma        float64 `json:"gamma"`
+	Epsilon      float64 `json:"epsilon"`
+	EpsilonDecay float64 `json:"epsilon_decay"`
+	Lambda       float64 `json:"lambda"`
+}
+
+// sweepRow aggregates one sweep point across seeds.
+type sweepRow struct {
+	sweepPoint
+	Seeds             int     `json:"seeds"`
+	SuccessRateMean   float64 `json:"success_rate_mean"`
+	SuccessRateStddev float64 `json:"success_rate_stddev"`
+	RewardMean        float64 `json:"reward_mean"`
+	RewardStddev      float64 `json:"reward_stddev"`
+}
+
+func runSweep(args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	algorithms := fs.String("algorithm", engine.AlgorithmQLearning, "comma-separated algorithms to sweep")
+	alphas := fs.String("alpha", "0.2", "learning rates: list a,b,c or range start:stop:step")
+	gammas := fs.String("gamma", "0.9", "discount factors: list or range")
+	epsilons := fs.String("epsilon", "0.5", "initial exploration rates: list or range")
+	epsilonDecays := fs.String("epsilon-decay", "0.998", "per-episode epsilon decay: list or range")
+	lambdas := fs.String("lambda", "0.9", "eligibility trace decay for sarsa-lambda/q-lambda: list or range")
+	samples := fs.Int("random", 0, "sample this many distinct random points from the grid instead of the full Cartesian product")
+	sampleSeed := fs.Int64("sample-seed", 1, "seed for --random sampling")
+	seeds := fs.Int("seeds", 3, "training seeds per point (1..N)")
+	workers := fs.Int("workers", runtime.NumCPU(), "parallel training runs")
+	window := fs.Int("window", 100, "final episodes averaged for success rate and reward (0 uses all)")
+	episodes := fs.Int("episodes", 300, "training episodes per run")
+	envName := fs.String("env", engine.EnvGridworld, "environment (gridworld, coop)")
+	rows := fs.Int("rows", 0, "grid rows (0 uses the environment's default size)")
+	cols := fs.Int("cols", 0, "grid columns (0 uses the environment's default size)")
+	maxSteps := fs.Int("max-steps", 0, "maximum steps per episode (0 uses default)")
+	epsilonMin := fs.Float64("epsilon-min", 0.05, "minimum exploration rate")
+	var goals goalListFlag
+	fs.Func("goal", "goal specification row,col,reward (repeatable)", goals.Set)
+	stepPenalty := fs.Float64("step-penalty", 0.02, "per-step penalty (non-negative)")
+	var wallPositions positionListFlag
+	fs.Func("wall", "wall tile at row,col (repeatable)", wallPositions.Set)
+	var slipTiles slipListFlag
+	fs.Func("slip", "slip tile row,col,probability (repeatable)", slipTiles.Set)
+	outCSV := fs.String("out-csv", "", "write the aggregated results as CSV at path")
+	outJSON := fs.String("out-json", "", "write the aggregated results as JSON at path")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	algorithmList := strings.Split(*algorithms, ",")
+	for i, name := range algorithmList {
+		algorithmList[i] = strings.TrimSpace(name)
+	}
+	alphaList, err := parseSweepValues("alpha", *alphas, 0, 1)
+	if err != nil {
+		return err
+	}
+	gammaList, err := parseSweepValues("gamma", *gammas, 0, 1)
+	if err != nil {
+		return err
+	}
+	epsilonList, err := parseSweepValues("epsilon", *epsilons, 0, 1)
+	if err != nil {
+		return err
+	}
+	decayList, err := parseSweepValues("epsilon-decay", *epsilonDecays, 0, 1)
+	if err != nil {
+		return err
+	}
+	lambdaList, err := parseSweepValues("lambda", *lambdas, 0, 1)
+	if err != nil {
+		return err
+	}
+	if *samples < 0 {
+		return fmt.Errorf("random must be non-negative (got %d)", *samples)
+	}
+	if *seeds <= 0 {
+		return fmt.Errorf("seeds must be positive (got %d)", *seeds)
+	}
+	if *workers <= 0 {
+		return fmt.Errorf("workers must be positive (got %d)", *workers)
+	}
+	if *window < 0 {
+		return fmt.Errorf("window must be non-negative (got %d)", *window)
+	}
+	if *episodes <= 0 {
+		return fmt.Errorf("episodes must be positive (got %d)", *episodes)
+	}
+
+	var points []sweepPoint
+	for _, algorithm := range algorithmList {
+		// Lambda only matters for trace algorithms, so other algorithms are not repeated across it.
+		lambdasFor := lambdaList
+		if algorithm != engine.AlgorithmSARSALambda && algorithm != engine.AlgorithmQLambda {
+			lambdasFor = lambdaList[:1]
+		}
+		for _, alpha := range alphaList {
+			for _, gamma := range gammaList {
+				for _, epsilon := range epsilonList {
+					for _, decay := range decayList {
+						for _, lambda := range lambdasFor {
+							points = append(points, sweepPoint{algorithm, alpha, gamma, epsilon, decay, lambda})
+						}
+					}
+				}
+			}
+		}
+	}
+	if *samples > 0 && *samples < len(points) {
+		// Sampling without replacement never trains the same point twice.
+		rng := rand.New(rand.NewSource(*sampleSeed))
+		rng.Shuffle(len(points), func(i, j int) { points[i], points[j] = points[j], points[i] })
+		points = points[:*samples]
+	}
+
+	var cfgs []engine.Config
+	for _, point := range points {
+		for seed := 1; seed <= *seeds; seed++ {
+			cfgs = append(cfgs, engine.Config{
+				Env:          *envName,
+				Episodes:     *episodes,
+				Seed:         int64(seed),
+				Epsilon:      point.Epsilon,
+				EpsilonMin:   math.Min(*epsilonMin, point.Epsilon),
+				EpsilonDecay: point.EpsilonDecay,
+				Alpha:        point.Alpha,
+				Gamma:        point.Gamma,
+				Lambda:       point.Lambda,
+				Rows:         *rows,
+				Cols:         *cols,
+				MaxSteps:     *maxSteps,
+				Algorithm:    point.Algorithm,
+				Goals:        goals.Goals,
+				StepPenalty:  *stepPenalty,
+				Walls:        wallPositions.Positions,
+				Slips:        slipTiles.Slips,
+			})
+		}
+	}
+	// Every seed of a point shares its settings, so validating the first one per point covers the grid
+	// before any worker starts.
+	for i := 0; i < len(cfgs); i += *seeds {
+		if err := cfgs[i].Validate(); err != nil {
+			point := points[i / *seeds]
+			return fmt.Errorf("sweep point %s alpha=%g gamma=%g epsilon=%g epsilon-decay=%g lambda=%g: %w",
+				point.Algorithm, point.Alpha, point.Gamma, point.Epsilon, point.EpsilonDecay, point.Lambda, err)
+		}
+	}
+	fmt.Printf("sweep config => points=%d seeds=%d runs=%d workers=%d episodes=%d window=%d\n", len(points), *seeds, len(cfgs), *workers, *episodes, *window)
+
+	results := engine.TrainAll(context.Background(), cfgs, *workers)
+	aggregated := make([]sweepRow, len(points))
+	for i, point := range points {
+		successes := make([]float64, *seeds)
+		rewards := make([]float64, *seeds)
+		for s := 0; s < *seeds; s++ {
+			rewards[s], successes[s] = results[i**seeds+s].Window(*window)
+		}
+		row := sweepRow{sweepPoint: point, Seeds: *seeds}
+		row.SuccessRateMean, row.SuccessRateStddev = engine.MeanStd(successes)
+		row.RewardMean, row.RewardStddev = engine.MeanStd(rewards)
+		aggregated[i] = row
+	}
+
+	if *outCSV != "" {
+		if err := writeSweepCSV(*outCSV, aggregated); err != nil {
+			return err
+		}
+	}
+	if *outJSON != "" {
+		if err := writeSweepJSON(*outJSON, aggregated); err != nil {
+			return err
+		}
+	}
+
+	ranked := append([]sweepRow(nil), aggregated...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].SuccessRateMean != ranked[j].SuccessRateMean {
+			return ranked[i].SuccessRateMean > ranked[j].SuccessRateMean
+		}
+		return ranked[i].RewardMean > ranked[j].RewardMean
+	})
+	fmt.Println("best configurations:")
+	for i := 0; i < len(ranked) && i < 5; i++ {
+		row := ranked[i]
+		fmt.Printf("  %s alpha=%.3f gamma=%.3f epsilon=%.3f epsilonDecay=%.4f lambda=%.2f => success=%.3f±%.3f reward=%.3f±%.3f\n",
+			row.Algorithm, row.Alpha, row.Gamma, row.Epsilon, row.EpsilonDecay, row.Lambda,
+			row.SuccessRateMean, row.SuccessRateStddev, row.RewardMean, row.RewardStddev)
+	}
+	return nil
+}
+
+// parseSweepValues accepts a comma-separated list or an inclusive start:stop:step range.
+func parseSweepValues(name, spec string, min, max float64) ([]float64, error) {
+	var values []float64
+	if strings.Contains(spec, ":") {
+		parts := strings.Split(spec, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%s range must be start:stop:step", name)
+		}
+		var bounds [3]float64
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s range: %w", name, err)
+			}
+			bounds[i] = v
+		}
+		start, stop, step := bounds[0], bounds[1], bounds[2]
+		if step <= 0 || stop < start {
+			return nil, fmt.Errorf("%s range needs start <= stop and a positive step", name)
+		}
+		for i := 0; ; i++ {
+			v := start + float64(i)*step
+			if v > stop+step*1e-9 {
+				break
+			}
+			values = append(values, math.Round(v*1e9)/1e9)
+		}
+	} else {
+		for _, part := range strings.Split(spec, ",") {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value: %w", name, err)
+			}
+			values = append(values, v)
+		}
+	}
+	for _, v := range values {
+		if v < min || v > max {
+			return nil, fmt.Errorf("%s values must be between %.0f and %.0f (got %.4f)", name, min, max, v)
+		}
+	}
+	return values, nil
+}
+
+func writeSweepCSV(path string, rows []sweepRow) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create sweep csv: %w", err)
+	}
+	writer := csv.NewWriter(file)
+	header := []string{"algorithm", "alpha", "gamma", "epsilon", "epsilon_decay", "lambda", "seeds", "success_rate_mean", "success_rate_stddev", "reward_mean", "reward_stddev"}
+	if err := writer.Write(header); err != nil {
+		file.Close()
+		return fmt.Errorf("write sweep header: %w", err)
+	}
+	for _, row := range rows {
+		record := []string{
+			row.Algorithm,
+			fmt.Sprintf("%.6f", row.Alpha),
+			fmt.Sprintf("%.6f", row.Gamma),
+			fmt.Sprintf("%.6f", row.Epsilon),
+			fmt.Sprintf("%.6f", row.EpsilonDecay),
+			fmt.Sprintf("%.6f", row.Lambda),
+			strconv.Itoa(row.Seeds),
+			fmt.Sprintf("%.6f", row.SuccessRateMean),
+			fmt.Sprintf("%.6f", row.SuccessRateStddev),
+			fmt.Sprintf("%.6f", row.RewardMean),
+			fmt.Sprintf("%.6f", row.RewardStddev),
+		}
+		if err := writer.Write(record); err != nil {
+			file.Close()
+			return fmt.Errorf("write sweep row: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return fmt.Errorf("flush sweep csv: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close sweep csv: %w", err)
+	}
+	return nil
+}
+
+func writeSweepJSON(path string, rows []sweepRow) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create sweep json: %w", err)
+	}
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(rows); err != nil {
+		file.Close()
+		return fmt.Errorf("write sweep json: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close sweep json: %w", err)
+	}
+	return nil
+}
@@ -11,45 +11,100 @@ type position struct {
 }
 
 type epsilonGreedyAgent struct {
-	rng         *rand.Rand
-	values      *valueTable
-	qvalues     *qTable
-	epsilon     float64
-	qVisits     map[actionKey]int
+	rng     *rand.Rand
+	values  *valueTable
+	qvalues *qTable
+	epsilon float64
+	// softmax switches Q-table action selection from ε-greedy to Boltzmann sampling at temperature.
+	softmax     bool
+	temperature float64
+	// ucb picks actions by UCB1 over qVisits instead; ucbConstant weighs the confidence bound.
+	ucb         bool
+	ucbConstant float64
+	qVisits     *visitTable
 	stateVisits map[position]int
+	// With recordProbability set, probability holds the behaviour policy's probability of the action
+	// actInState last chose, which off-policy learners divide by.
+	recordProbability bool
+	probability       float64
 }
 
 func newEpsilonGreedyAgent(rng *rand.Rand, values *valueTable, qvalues *qTable, epsilon float64) *epsilonGreedyAgent {
-	return &epsilonGreedyAgent{
+	agent := &epsilonGreedyAgent{
 		rng:         rng,
 		values:      values,
 		qvalues:     qvalues,
 		epsilon:     epsilon,
-		qVisits:     make(map[actionKey]int),
 		stateVisits: make(map[position]int),
 	}
+	if qvalues != nil {
+		agent.qVisits = newVisitTable(qvalues.states, qvalues.actions)
+	}
+	return agent
 }
 
-func (a *epsilonGreedyAgent) act(env *gridworldEnv) int {
+func (a *epsilonGreedyAgent) act(env Environment) int {
+	if a.qvalues != nil {
+		return a.actInState(env.State())
+	}
 	var chosen int
 	if a.rng.Float64() < a.epsilon {
-		chosen = a.rng.Intn(4)
-	} else if a.qvalues != nil {
-		chosen = a.greedyQAction(env)
+		chosen = a.rng.Intn(env.NumActions())
+	} else if grid, ok := env.(*gridworldEnv); ok {
+		chosen = a.greedyValueAction(grid)
 	} else {
-		chosen = a.greedyValueAction(env)
+		chosen = a.rng.Intn(env.NumActions())
 	}
 	a.recordVisit(env, chosen)
 	return chosen
 }
 
+// actInState picks an ε-greedy or Boltzmann action over the Q-table for an explicit state id, for learners
+// that observe a view of a shared environment rather than the environment itself.
+func (a *epsilonGreedyAgent) actInState(state int) int {
+	var chosen int
+	switch {
+	case a.softmax:
+		chosen = a.softmaxQAction(state)
+	case a.ucb:
+		chosen = a.ucbQAction(state)
+	case a.rng.Float64() < a.epsilon:
+		chosen = a.rng.Intn(a.qvalues.actions)
+	default:
+		chosen = a.greedyQAction(state)
+	}
+	if a.recordProbability {
+		a.probability = a.actionProbability(state, chosen)
+	}
+	a.qVisits.inc(state, chosen)
+	return chosen
+}
+
+// actionProbability is the probability that actInState picks action in state under the current Q-values
+// and visit counts.
+func (a *epsilonGreedyAgent) actionProbability(state, action int) float64 {
+	switch {
+	case a.softmax && a.temperature > 0:
+		best := a.qvalues.maxValue(state)
+		sum := 0.0
+		for _, value := range a.qvalues.row(state) {
+			sum += math.Exp((value - best) / a.temperature)
+		}
+		return math.Exp((a.qvalues.get(state, action)-best)/a.temperature) / sum
+	case a.softmax:
+		return a.greedyProbability(state, action)
+	case a.ucb:
+		return a.ucbProbability(state, action)
+	}
+	return a.epsilon/float64(a.qvalues.actions) + (1-a.epsilon)*a.greedyProbability(state, action)
+}
+
 func (a *epsilonGreedyAgent) update(reward float64) {
 	_ = reward
 }
 
 type actionKey struct {
-	row    int
-	col    int
+	state  int
 	action int
 }
 
@@ -58,21 +113,244 @@ type candidate struct {
 	visits int
 }
 
-func (a *epsilonGreedyAgent) greedyQAction(env *gridworldEnv) int {
-	row, col := env.currRow, env.currCol
-	bestScore := math.Inf(-1)
-	var candidates []candidate
-	for action := 0; action < 4; action++ {
-		score := a.qvalues.get(row, col, action)
-		if score > bestScore {
-			bestScore = score
-			candidates = candidates[:0]
-			candidates = append(candidates, candidate{action: action, visits: a.qVisits[actionKey{row, col, action}]})
-		} else if score == bestScore {
-			candidates = append(candidates, candidate{action: action, visits: a.qVisits[actionKey{row, col, action}]})
+// greedyQAction picks the best-valued action, breaking ties toward the least-visited ones and then
+// uniformly. It draws from the rng exactly like pickLeastVisited but without building candidate slices,
+// since it runs on every step.
+func (a *epsilonGreedyAgent) greedyQAction(state int) int {
+	row := a.qvalues.row(state)
+	best := math.Inf(-1)
+	least := 0
+	ties := 0
+	for action, score := range row {
+		visits := a.qVisits.get(state, action)
+		switch {
+		case score > best:
+			best, least, ties = score, visits, 1
+		case score == best && visits < least:
+			least, ties = visits, 1
+		case score == best && visits == least:
+			ties++
 		}
 	}
-	return pickLeastVisited(candidates, a.rng)
+	if ties == 0 {
+		return 0
+	}
+	pick := a.rng.Intn(ties)
+	for action, score := range row {
+		if score != best || a.qVisits.get(state, action) != least {
+			continue
+		}
+		if pick == 0 {
+			return action
+		}
+		pick--
+	}
+	return 0
+}
+
+// greedyProbability is the probability that greedyQAction picks action: an even share among the
+// best-valued actions with the fewest visits.
+func (a *epsilonGreedyAgent) greedyProbability(state, action int) float64 {
+	row := a.qvalues.row(state)
+	best := math.Inf(-1)
+	least := 0
+	ties := 0
+	for candidate, score := range row {
+		visits := a.qVisits.get(state, candidate)
+		switch {
+		case score > best:
+			best, least, ties = score, visits, 1
+		case score == best && visits < least:
+			least, ties = visits, 1
+		case score == best && visits == least:
+			ties++
+		}
+	}
+	if row[action] != best || a.qVisits.get(state, action) != least {
+		return 0
+	}
+	return 1 / float64(ties)
+}
+
+// softmaxQAction samples an action with probability proportional to exp(Q/τ). The weights are shifted by
+// the best value so large Q-values cannot overflow; a zero temperature is greedy.
+func (a *epsilonGreedyAgent) softmaxQAction(state int) int {
+	if a.temperature <= 0 {
+		return a.greedyQAction(state)
+	}
+	row := a.qvalues.row(state)
+	best := a.qvalues.maxValue(state)
+	sum := 0.0
+	for _, value := range row {
+		sum += math.Exp((value - best) / a.temperature)
+	}
+	r := a.rng.Float64() * sum
+	for action, value := range row {
+		r -= math.Exp((value - best) / a.temperature)
+		if r < 0 {
+			return action
+		}
+	}
+	return len(row) - 1
+}
+
+// expectedQValue returns the expectation of Q at state under the agent's current behaviour policy.
+// The ε-greedy expectation spreads the greedy probability mass evenly across tied best actions.
+func (a *epsilonGreedyAgent) expectedQValue(state int) float64 {
+	if a.qvalues == nil {
+		return 0
+	}
+	if a.softmax && a.temperature > 0 {
+		return a.expectedSoftmaxValue(state)
+	}
+	if a.ucb {
+		return a.expectedUCBValue(state)
+	}
+	actions := a.qvalues.actions
+	best := a.qvalues.maxValue(state)
+	ties := 0
+	sum := 0.0
+	bestSum := 0.0
+	for action := 0; action < actions; action++ {
+		value := a.qvalues.get(state, action)
+		sum += value
+		if value == best {
+			ties++
+			bestSum += value
+		}
+	}
+	// Softmax at zero temperature acts greedily and never reads ε.
+	epsilon := a.epsilon
+	if a.softmax {
+		epsilon = 0
+	}
+	explore := epsilon / float64(actions)
+	return explore*sum + (1-epsilon)*bestSum/float64(ties)
+}
+
+func (a *epsilonGreedyAgent) expectedSoftmaxValue(state int) float64 {
+	best := a.qvalues.maxValue(state)
+	weights, weighted := 0.0, 0.0
+	for _, value := range a.qvalues.row(state) {
+		weight := math.Exp((value - best) / a.temperature)
+		weights += weight
+		weighted += weight * value
+	}
+	return weighted / weights
+}
+
+// ucbQAction picks the action maximizing Q(s,a) + c·√(ln N(s) / n(s,a)), where n(s,a) counts how often
+// the action was taken in state and N(s) sums those counts. Untried actions come first, uniformly at
+// random, and ties are broken uniformly too.
+func (a *epsilonGreedyAgent) ucbQAction(state int) int {
+	if untried := a.untriedActions(state); untried > 0 {
+		pick := a.rng.Intn(untried)
+		for action := 0; action < a.qvalues.actions; action++ {
+			if a.qVisits.get(state, action) != 0 {
+				continue
+			}
+			if pick == 0 {
+				return action
+			}
+			pick--
+		}
+	}
+	best := math.Inf(-1)
+	choice := 0
+	ties := 0
+	logTotal := math.Log(float64(a.stateVisitCount(state)))
+	for action := 0; action < a.qvalues.actions; action++ {
+		score := a.ucbScore(state, action, logTotal)
+		switch {
+		case score > best:
+			best, choice, ties = score, action, 1
+		case score == best:
+			ties++
+			if a.rng.Intn(ties) == 0 {
+				choice = action
+			}
+		}
+	}
+	return choice
+}
+
+// expectedUCBValue averages Q over the actions UCB1 would pick in state: the untried ones if there are
+// any, otherwise those tied for the best bound.
+func (a *epsilonGreedyAgent) expectedUCBValue(state int) float64 {
+	if untried := a.untriedActions(state); untried > 0 {
+		sum := 0.0
+		for action := 0; action < a.qvalues.actions; action++ {
+			if a.qVisits.get(state, action) == 0 {
+				sum += a.qvalues.get(state, action)
+			}
+		}
+		return sum / float64(untried)
+	}
+	logTotal := math.Log(float64(a.stateVisitCount(state)))
+	best := math.Inf(-1)
+	sum := 0.0
+	ties := 0
+	for action := 0; action < a.qvalues.actions; action++ {
+		score := a.ucbScore(state, action, logTotal)
+		switch {
+		case score > best:
+			best, sum, ties = score, a.qvalues.get(state, action), 1
+		case score == best:
+			sum += a.qvalues.get(state, action)
+			ties++
+		}
+	}
+	return sum / float64(ties)
+}
+
+// ucbProbability is the probability that ucbQAction picks action: an even share of the untried actions,
+// or of those tied for the best bound once every action was tried.
+func (a *epsilonGreedyAgent) ucbProbability(state, action int) float64 {
+	if untried := a.untriedActions(state); untried > 0 {
+		if a.qVisits.get(state, action) != 0 {
+			return 0
+		}
+		return 1 / float64(untried)
+	}
+	logTotal := math.Log(float64(a.stateVisitCount(state)))
+	best := math.Inf(-1)
+	ties := 0
+	for candidate := 0; candidate < a.qvalues.actions; candidate++ {
+		score := a.ucbScore(state, candidate, logTotal)
+		switch {
+		case score > best:
+			best, ties = score, 1
+		case score == best:
+			ties++
+		}
+	}
+	if a.ucbScore(state, action, logTotal) != best {
+		return 0
+	}
+	return 1 / float64(ties)
+}
+
+func (a *epsilonGreedyAgent) ucbScore(state, action int, logTotal float64) float64 {
+	visits := float64(a.qVisits.get(state, action))
+	return a.qvalues.get(state, action) + a.ucbConstant*math.Sqrt(logTotal/visits)
+}
+
+func (a *epsilonGreedyAgent) untriedActions(state int) int {
+	untried := 0
+	for action := 0; action < a.qvalues.actions; action++ {
+		if a.qVisits.get(state, action) == 0 {
+			untried++
+		}
+	}
+	return untried
+}
+
+func (a *epsilonGreedyAgent) stateVisitCount(state int) int {
+	total := 0
+	for action := 0; action < a.qvalues.actions; action++ {
+		total += a.qVisits.get(state, action)
+	}
+	return total
 }
 
 func (a *epsilonGreedyAgent) greedyValueAction(env *gridworldEnv) int {
@@ -114,14 +392,15 @@ func pickLeastVisited(candidates []candidate, rng *rand.Rand) int {
 	return options[rng.Intn(len(options))]
 }
 
-func (a *epsilonGreedyAgent) recordVisit(env *gridworldEnv, action int) {
+func (a *epsilonGreedyAgent) recordVisit(env Environment, action int) {
 	if a.qvalues != nil {
-		key := actionKey{row: env.currRow, col: env.currCol, action: action}
-		a.qVisits[key]++
+		a.qVisits.inc(env.State(), action)
 		return
 	}
-	row, col := env.nextPosition(action)
-	a.stateVisits[position{row: row, col: col}]++
+	if grid, ok := env.(*gridworldEnv); ok {
+		row, col := grid.nextPosition(action)
+		a.stateVisits[position{row: row, col: col}]++
+	}
 }
 
 func (a *epsilonGreedyAgent) setEpsilon(value float64) {
@@ -134,45 +413,24 @@ func (a *epsilonGreedyAgent) setEpsilon(value float64) {
 	a.epsilon = value
 }
 
-func (a *epsilonGreedyAgent) softmaxValueAction(env *gridworldEnv, temperature float64) int {
-	if a.values == nil || temperature <= 0 {
-		return a.greedyValueAction(env)
-	}
-	var scores [4]float64
-	var maxScore float64 = math.Inf(-1)
-	for action := 0; action < 4; action++ {
-		row, col := env.nextPosition(action)
-		feature := 0
-		if a.values.mapper != nil {
-			feature = a.values.mapper.Index(env, row, col)
-		}
-		score := a.values.get(row, col, feature) / temperature
-		scores[action] = score
-		if score > maxScore {
-			maxScore = score
-		}
-	}
-	var sum float64
-	for action := 0; action < 4; action++ {
-		scores[action] = math.Exp(scores[action] - maxScore)
-		sum += scores[action]
-	}
-	if sum == 0 {
-		return a.greedyValueAction(env)
-	}
-	r := a.rng.Float64() * sum
-	acc := 0.0
-	for action := 0; action < 4; action++ {
-		acc += scores[action]
-		if r <= acc {
-			a.recordVisit(env, action)
-			return action
-		}
+// explore applies cfg's exploration strategy.
+func (a *epsilonGreedyAgent) explore(cfg Config) {
+	a.softmax = cfg.Exploration == ExplorationSoftmax
+	a.temperature = cfg.SoftmaxTemperature
+	a.ucb = cfg.Exploration == ExplorationUCB
+	a.ucbConstant = cfg.UCBConstant
+}
+
+func (a *epsilonGreedyAgent) setTemperature(value float64) {
+	if value < 0 {
+		value = 0
 	}
-	return a.greedyValueAction(env)
+	a.temperature = value
 }
 
 func (a *epsilonGreedyAgent) resetVisits() {
-	a.qVisits = make(map[actionKey]int)
-	a.stateVisits = make(map[position]int)
+	if a.qVisits != nil {
+		a.qVisits.reset()
+	}
+	clear(a.stateVisits)
 }
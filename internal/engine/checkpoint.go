@@ -0,0 +1,249 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+)
+
+// CheckpointVersion is bumped whenever the checkpoint layout changes incompatibly, and a number is never
+// reused. Version 2 stored the softmax temperature, version 3 added the off-policy Monte Carlo importance
+// weights and version 4 dropped the temperature again, since resumed runs derive it from the schedules.
+const CheckpointVersion = 4
+
+// Checkpoint is the persisted state of a Trainer: enough to resume training or to evaluate the learned
+// policy later. It is plain JSON so the CLI and the WASM build read the same files. Eligibility traces
+// and n-step buffers are per-episode and Dyna models are rebuilt from fresh experience, so none is stored.
+type Checkpoint struct {
+	Version int `json:"version"`
+	// Config is the configuration the trainer was created with, before normalization. Schedules whose
+	// length defaulted to the run length keep it, so resuming for more episodes continues them unchanged.
+	Config            Config         `json:"config"`
+	QValues           [][][]float64  `json:"q_values"`
+	DoubleQ           [][][]float64  `json:"double_q,omitempty"`
+	Visits            [][]VisitCount `json:"visits"`
+	Step              int            `json:"step"`
+	EpisodesCompleted int            `json:"episodes_completed"`
+	SuccessCount      int            `json:"success_count"`
+	TotalReward       float64        `json:"total_reward"`
+	TotalSteps        int            `json:"total_steps"`
+	RNG               CheckpointRNG  `json:"rng"`
+	// ImportanceWeights are off-policy Monte Carlo's cumulative importance sampling weights or return
+	// counts, which scale its future updates.
+	ImportanceWeights [][]float64 `json:"importance_weights,omitempty"`
+}
+
+// VisitCount is how often a learner picked action in state.
+type VisitCount struct {
+	State  int `json:"state"`
+	Action int `json:"action"`
+	Count  int `json:"count"`
+}
+
+// CheckpointRNG records the trainer's random stream as its seed and the number of values drawn so far.
+type CheckpointRNG struct {
+	Seed  int64  `json:"seed"`
+	Draws uint64 `json:"draws"`
+}
+
+// countingSource wraps the standard source and counts draws so a checkpoint can replay the stream to
+// the same position.
+type countingSource struct {
+	src   rand.Source64
+	seed  int64
+	draws uint64
+}
+
+func newCountingSource(seed int64) *countingSource {
+	if seed == 0 {
+		seed = 1
+	}
+	return &countingSource{src: rand.NewSource(seed).(rand.Source64), seed: seed}
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.draws++
+	return s.src.Uint64()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.seed = seed
+	s.draws = 0
+}
+
+// restore reseeds the source and skips ahead to the recorded position.
+func (s *countingSource) restore(state CheckpointRNG) {
+	s.Seed(state.Seed)
+	for s.draws < state.Draws {
+		s.Uint64()
+	}
+}
+
+// learners returns the epsilon-greedy agents whose Q-tables make up the checkpoint, in a stable order.
+func (t *Trainer) learners() []*epsilonGreedyAgent {
+	if t.coop != nil {
+		return t.coopAgents[:]
+	}
+	return []*epsilonGreedyAgent{t.agent}
+}
+
+// Checkpoint captures the trainer's learned state. Call it once Run's channel has been drained.
+func (t *Trainer) Checkpoint() *Checkpoint {
+	cp := &Checkpoint{
+		Version:           CheckpointVersion,
+		Config:            t.requested,
+		Step:              t.step,
+		EpisodesCompleted: t.episodesCompleted,
+		SuccessCount:      t.successCount,
+		TotalReward:       t.totalReward,
+		TotalSteps:        t.totalSteps,
+	}
+	cp.Config.EpsilonSchedule = withHorizon(t.requested.EpsilonSchedule, t.cfg.EpsilonSchedule)
+	cp.Config.AlphaSchedule = withHorizon(t.requested.AlphaSchedule, t.cfg.AlphaSchedule)
+	cp.Config.TemperatureSchedule = withHorizon(t.requested.TemperatureSchedule, t.cfg.TemperatureSchedule)
+	for _, agent := range t.learners() {
+		cp.QValues = append(cp.QValues, agent.qvalues.rows())
+		cp.Visits = append(cp.Visits, visitCounts(agent.qVisits))
+	}
+	if t.doubleQ[0] != nil {
+		for _, table := range t.doubleQ {
+			cp.DoubleQ = append(cp.DoubleQ, table.rows())
+		}
+	}
+	if t.mcWeights != nil {
+		cp.ImportanceWeights = t.mcWeights.rows()
+	}
+	if t.source != nil {
+		cp.RNG = CheckpointRNG{Seed: t.source.seed, Draws: t.source.draws}
+	}
+	return cp
+}
+
+// Restore loads a checkpoint into a trainer built from the same configuration.
+func (t *Trainer) Restore(cp *Checkpoint) error {
+	if err := checkVersion(cp.Version); err != nil {
+		return err
+	}
+	learners := t.learners()
+	if len(cp.QValues) != len(learners) || len(cp.Visits) != len(learners) {
+		return fmt.Errorf("checkpoint has %d Q-tables, trainer needs %d", len(cp.QValues), len(learners))
+	}
+	for i, agent := range learners {
+		if err := loadRows(agent.qvalues, cp.QValues[i]); err != nil {
+			return err
+		}
+	}
+	if t.doubleQ[0] != nil {
+		if len(cp.DoubleQ) != len(t.doubleQ) {
+			return fmt.Errorf("checkpoint has %d double Q-tables, trainer needs %d", len(cp.DoubleQ), len(t.doubleQ))
+		}
+		for i, table := range t.doubleQ {
+			if err := loadRows(table, cp.DoubleQ[i]); err != nil {
+				return err
+			}
+		}
+	}
+	if t.mcWeights != nil {
+		if err := loadRows(t.mcWeights, cp.ImportanceWeights); err != nil {
+			return fmt.Errorf("importance weights: %w", err)
+		}
+	}
+	for i, agent := range learners {
+		agent.qVisits.reset()
+		for _, visit := range cp.Visits[i] {
+			if visit.State < 0 || visit.State >= agent.qvalues.states || visit.Action < 0 || visit.Action >= agent.qvalues.actions {
+				return fmt.Errorf("checkpoint visit count for state %d action %d is out of range", visit.State, visit.Action)
+			}
+			agent.qVisits.counts[visit.State*agent.qVisits.actions+visit.Action] = visit.Count
+		}
+	}
+	t.step = cp.Step
+	t.episodesCompleted = cp.EpisodesCompleted
+	t.successCount = cp.SuccessCount
+	t.totalReward = cp.TotalReward
+	t.totalSteps = cp.TotalSteps
+	// Epsilon, alpha and the temperature follow from the schedules and the episodes already trained.
+	t.applySchedules(t.episodesCompleted)
+	if t.grid != nil && t.cfg.WallSwitchEpisode > 0 && t.episodesCompleted >= t.cfg.WallSwitchEpisode {
+		t.switchWalls()
+	}
+	if t.source != nil {
+		t.source.restore(cp.RNG)
+	}
+	return nil
+}
+
+// NewTrainerFromCheckpoint rebuilds a trainer for one of the built-in environments and restores cp into it.
+// The checkpoint's Config.Episodes sets how many further episodes Run trains.
+func NewTrainerFromCheckpoint(cp *Checkpoint) (*Trainer, error) {
+	trainer := NewTrainer(cp.Config)
+	if err := trainer.Restore(cp); err != nil {
+		return nil, err
+	}
+	return trainer, nil
+}
+
+// WriteCheckpoint encodes cp as indented JSON.
+func WriteCheckpoint(w io.Writer, cp *Checkpoint) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cp); err != nil {
+		return fmt.Errorf("encode checkpoint: %w", err)
+	}
+	return nil
+}
+
+// ReadCheckpoint decodes a checkpoint written by WriteCheckpoint and checks its version.
+func ReadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	var cp Checkpoint
+	if err := json.NewDecoder(r).Decode(&cp); err != nil {
+		return nil, fmt.Errorf("decode checkpoint: %w", err)
+	}
+	if err := checkVersion(cp.Version); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// checkVersion rejects checkpoints in any other layout. Older layouts are not migrated: each change either
+// added state that cannot be recovered or stored a value that would now be read differently.
+func checkVersion(version int) error {
+	switch {
+	case version > CheckpointVersion:
+		return fmt.Errorf("checkpoint version %d is newer than this build reads (version %d)", version, CheckpointVersion)
+	case version < CheckpointVersion:
+		return fmt.Errorf("checkpoint version %d is older than this build reads (version %d); train again to save a current checkpoint", version, CheckpointVersion)
+	}
+	return nil
+}
+
+func loadRows(q *qTable, rows [][]float64) error {
+	if len(rows) != q.states {
+		return fmt.Errorf("checkpoint Q-table has %d states, trainer needs %d", len(rows), q.states)
+	}
+	for s, row := range rows {
+		if len(row) != q.actions {
+			return fmt.Errorf("checkpoint Q-table state %d has %d actions, trainer needs %d", s, len(row), q.actions)
+		}
+		copy(q.row(s), row)
+	}
+	return nil
+}
+
+// visitCounts lists the non-zero counters in state, then action order.
+func visitCounts(visits *visitTable) []VisitCount {
+	out := []VisitCount{}
+	for i, count := range visits.counts {
+		if count != 0 {
+			out = append(out, VisitCount{State: i / visits.actions, Action: i % visits.actions, Count: count})
+		}
+	}
+	return out
+}
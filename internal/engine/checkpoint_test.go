@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func drain(trainer *Trainer) Snapshot {
+	var final Snapshot
+	for snapshot := range trainer.Run(context.Background()) {
+		final = snapshot
+	}
+	return final
+}
+
+func TestCheckpointResumeMatchesUninterruptedRun(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmQLearning, AlgorithmDoubleQ, AlgorithmSARSALambda, AlgorithmOffPolicyMonteCarlo} {
+		t.Run(algorithm, func(t *testing.T) {
+			cfg := Config{
+				Episodes:     60,
+				Seed:         11,
+				Algorithm:    algorithm,
+				Rows:         4,
+				Cols:         4,
+				Epsilon:      0.4,
+				EpsilonMin:   0.05,
+				EpsilonDecay: 0.97,
+				Alpha:        0.3,
+				Gamma:        0.9,
+				StepPenalty:  0.02,
+				Slips:        []SlipTile{{Row: 1, Col: 2, Probability: 0.3}},
+			}
+			straight := NewTrainer(cfg)
+			want := drain(straight)
+
+			cfg.Episodes = 30
+			first := NewTrainer(cfg)
+			drain(first)
+			var buf bytes.Buffer
+			if err := WriteCheckpoint(&buf, first.Checkpoint()); err != nil {
+				t.Fatalf("write checkpoint: %v", err)
+			}
+			checkpoint, err := ReadCheckpoint(&buf)
+			if err != nil {
+				t.Fatalf("read checkpoint: %v", err)
+			}
+			resumed, err := NewTrainerFromCheckpoint(checkpoint)
+			if err != nil {
+				t.Fatalf("restore checkpoint: %v", err)
+			}
+			got := drain(resumed)
+
+			if got.Episode != want.Episode || got.EpisodesCompleted != want.EpisodesCompleted {
+				t.Fatalf("expected resumed run to end at episode %d, got %d", want.Episode, got.Episode)
+			}
+			if got.TotalReward != want.TotalReward || got.TotalSteps != want.TotalSteps || got.SuccessCount != want.SuccessCount {
+				t.Fatalf("expected resumed totals to match the uninterrupted run")
+			}
+			if !reflect.DeepEqual(resumed.Checkpoint().QValues, straight.Checkpoint().QValues) {
+				t.Fatalf("expected resumed Q-values to match the uninterrupted run")
+			}
+		})
+	}
+}
+
+func TestCheckpointRoundTripsImportanceWeights(t *testing.T) {
+	for _, sampling := range []string{ImportanceWeighted, ImportanceOrdinary} {
+		cfg := Config{
+			Episodes:           40,
+			Seed:               9,
+			Algorithm:          AlgorithmOffPolicyMonteCarlo,
+			ImportanceSampling: sampling,
+			Epsilon:            0.4,
+			Gamma:              0.9,
+		}
+		straight := NewTrainer(cfg)
+		drain(straight)
+
+		cfg.Episodes = 20
+		first := NewTrainer(cfg)
+		drain(first)
+		var buf bytes.Buffer
+		if err := WriteCheckpoint(&buf, first.Checkpoint()); err != nil {
+			t.Fatalf("write checkpoint: %v", err)
+		}
+		checkpoint, err := ReadCheckpoint(&buf)
+		if err != nil {
+			t.Fatalf("read checkpoint: %v", err)
+		}
+		if !reflect.DeepEqual(checkpoint.ImportanceWeights, first.Checkpoint().ImportanceWeights) {
+			t.Fatalf("%s: expected the importance weights to survive the round trip", sampling)
+		}
+		resumed, err := NewTrainerFromCheckpoint(checkpoint)
+		if err != nil {
+			t.Fatalf("restore checkpoint: %v", err)
+		}
+		drain(resumed)
+		got, want := resumed.Checkpoint(), straight.Checkpoint()
+		if !reflect.DeepEqual(got.ImportanceWeights, want.ImportanceWeights) || !reflect.DeepEqual(got.QValues, want.QValues) {
+			t.Fatalf("%s: expected the resumed weights and Q-values to match the uninterrupted run", sampling)
+		}
+
+		// Without its weights, the next return would be averaged in as if it were the first.
+		checkpoint.ImportanceWeights = nil
+		if _, err := NewTrainerFromCheckpoint(checkpoint); err == nil {
+			t.Fatalf("%s: expected a checkpoint without importance weights to be rejected", sampling)
+		}
+	}
+}
+
+func TestCheckpointResumeKeepsScheduleHorizon(t *testing.T) {
+	cfg := Config{
+		Episodes:            40,
+		Seed:                5,
+		Algorithm:           AlgorithmQLearning,
+		Epsilon:             0.5,
+		EpsilonSchedule:     Schedule{Kind: ScheduleLinear, Final: 0.1},
+		Exploration:         ExplorationSoftmax,
+		SoftmaxTemperature:  1,
+		TemperatureSchedule: Schedule{Kind: ScheduleCosine, Final: 0.2},
+		Gamma:               0.9,
+		SnapshotPolicy:      SnapshotEpisodeEnd,
+	}
+	type rates struct{ epsilon, temperature float64 }
+	collect := func(trainer *Trainer) map[int]rates {
+		out := map[int]rates{}
+		for snapshot := range trainer.Run(context.Background()) {
+			if snapshot.Status == StatusEpisodeComplete {
+				out[snapshot.Episode] = rates{snapshot.Epsilon, snapshot.Temperature}
+			}
+		}
+		return out
+	}
+	want := collect(NewTrainer(cfg))
+
+	// Stop the 40-episode run halfway, then resume it for the remaining episodes the way the CLI does.
+	first := NewTrainer(cfg)
+	first.cfg.Episodes = 20
+	drain(first)
+	checkpoint := first.Checkpoint()
+	checkpoint.Config.Episodes = 20
+	resumed, err := NewTrainerFromCheckpoint(checkpoint)
+	if err != nil {
+		t.Fatalf("restore checkpoint: %v", err)
+	}
+	got := collect(resumed)
+	for episode := 21; episode <= 40; episode++ {
+		if math.Abs(got[episode].epsilon-want[episode].epsilon) > 1e-12 || math.Abs(got[episode].temperature-want[episode].temperature) > 1e-12 {
+			t.Fatalf("episode %d: resumed run explores with %+v, uninterrupted run with %+v", episode, got[episode], want[episode])
+		}
+	}
+}
+
+func TestCheckpointRejectsMismatches(t *testing.T) {
+	if _, err := ReadCheckpoint(strings.NewReader(`{"version": 99}`)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("expected an unknown checkpoint version to be rejected as newer, got %v", err)
+	}
+	// Versions 1 and 2 lack the importance weights and versions 2 and 3 carry a stored temperature that
+	// resumed runs no longer read, so none of them loads.
+	for version := 1; version < CheckpointVersion; version++ {
+		old := fmt.Sprintf(`{"version": %d, "config": {"algorithm": "q-learning"}, "temperature": 0.5}`, version)
+		_, err := ReadCheckpoint(strings.NewReader(old))
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("checkpoint version %d is older", version)) {
+			t.Fatalf("expected a clear error for a version %d checkpoint, got %v", version, err)
+		}
+		stale := NewTrainer(Config{Algorithm: AlgorithmQLearning}).Checkpoint()
+		stale.Version = version
+		if _, err := NewTrainerFromCheckpoint(stale); err == nil {
+			t.Fatalf("expected Restore to refuse a version %d checkpoint", version)
+		}
+	}
+	checkpoint := NewTrainer(Config{Algorithm: AlgorithmQLearning, Rows: 4, Cols: 4}).Checkpoint()
+	checkpoint.Config.Rows = 5
+	if _, err := NewTrainerFromCheckpoint(checkpoint); err == nil {
+		t.Fatalf("expected Q-tables of the wrong shape to be rejected")
+	}
+}
@@ -0,0 +1,318 @@
+package engine
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const coopAgents = 2
+
+// coopEnv is a two-agent gridworld split by a wall column. The single door in the wall is open only while
+// an agent stands on a pressure switch. One switch sits on the start side and the others lie under the
+// goals, so one agent has to hold the door for its partner, who then keeps it open from its own goal.
+type coopEnv struct {
+	rows, cols  int
+	wallCol     int
+	door        position
+	switches    []position
+	starts      [coopAgents]position
+	goals       [coopAgents]Goal
+	positions   [coopAgents]position
+	finished    [coopAgents]bool
+	stepPenalty float64
+	maxSteps    int
+	stepsTaken  int
+}
+
+func newCoopEnv(rows, cols int, stepPenalty float64, overrideMaxSteps int) *coopEnv {
+	if rows < 3 {
+		rows = 3
+	}
+	if cols < 5 {
+		cols = 5
+	}
+	wallCol := cols / 2
+	maxSteps := rows * cols * 5
+	if overrideMaxSteps > 0 {
+		maxSteps = overrideMaxSteps
+	}
+	reward := maxFloat(1, float64(rows+cols-2)/2.5)
+	env := &coopEnv{
+		rows:        rows,
+		cols:        cols,
+		wallCol:     wallCol,
+		door:        position{row: rows / 2, col: wallCol},
+		switches:    []position{{row: 0, col: wallCol - 1}, {row: 0, col: cols - 1}, {row: rows - 1, col: cols - 1}},
+		starts:      [coopAgents]position{{row: rows - 1, col: 0}, {row: 0, col: 0}},
+		goals:       [coopAgents]Goal{{Row: 0, Col: cols - 1, Reward: reward}, {Row: rows - 1, Col: cols - 1, Reward: reward}},
+		stepPenalty: stepPenalty,
+		maxSteps:    maxSteps,
+	}
+	env.reset()
+	return env
+}
+
+func (e *coopEnv) reset() {
+	e.positions = e.starts
+	e.finished = [coopAgents]bool{}
+	e.stepsTaken = 0
+}
+
+func (e *coopEnv) doorOpen() bool {
+	for _, pos := range e.positions {
+		for _, sw := range e.switches {
+			if pos == sw {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *coopEnv) blocked(pos position, open bool) bool {
+	if pos.col != e.wallCol {
+		return false
+	}
+	if pos == e.door {
+		return !open
+	}
+	return true
+}
+
+// step moves both agents at once; the door state is read before anyone moves. Both learners share the
+// team reward, and an agent that reached its goal stays parked there.
+func (e *coopEnv) step(actions [coopAgents]int) (float64, bool) {
+	if e.stepsTaken >= e.maxSteps {
+		return 0, true
+	}
+	open := e.doorOpen()
+	e.stepsTaken++
+	reward := -e.stepPenalty
+	for i := range e.positions {
+		if e.finished[i] {
+			continue
+		}
+		row, col := moveWithinBounds(e.rows, e.cols, e.positions[i].row, e.positions[i].col, actions[i])
+		next := position{row: row, col: col}
+		if e.blocked(next, open) {
+			next = e.positions[i]
+		}
+		e.positions[i] = next
+		if next.row == e.goals[i].Row && next.col == e.goals[i].Col {
+			e.finished[i] = true
+			reward += e.goals[i].Reward
+		}
+	}
+	if e.goalReached() {
+		return reward, true
+	}
+	if e.stepsTaken >= e.maxSteps {
+		reward -= e.stepPenalty * timeoutPenaltyMultiplier
+		return reward, true
+	}
+	return reward, false
+}
+
+// distance is agent's Manhattan distance to its own goal, the potential reward shaping works from. Like
+// the gridworld's, it ignores the wall and the door.
+func (e *coopEnv) distance(agent int) float64 {
+	pos, goal := e.positions[agent], e.goals[agent]
+	return float64(absInt(pos.row-goal.Row) + absInt(pos.col-goal.Col))
+}
+
+func (e *coopEnv) goalReached() bool {
+	for _, done := range e.finished {
+		if !done {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *coopEnv) numStates() int {
+	return e.rows * e.cols * 4
+}
+
+// observe encodes what one independent learner sees: its own cell, whether its partner has made it past
+// the wall (or finished), and whether the door is currently open.
+func (e *coopEnv) observe(agent int) int {
+	partner := e.positions[1-agent]
+	layer := 0
+	if e.finished[1-agent] || partner.col > e.wallCol {
+		layer |= 1
+	}
+	if e.doorOpen() {
+		layer |= 2
+	}
+	own := e.positions[agent]
+	return layer*e.rows*e.cols + own.row*e.cols + own.col
+}
+
+func (e *coopEnv) StatePosition(state int) Position {
+	cell := state % (e.rows * e.cols)
+	return Position{Row: cell / e.cols, Col: cell % e.cols}
+}
+
+func (e *coopEnv) StateLayer(state int) int {
+	return state / (e.rows * e.cols)
+}
+
+// DisplayLayer projects the first agent's value map for its current view of partner and door.
+func (e *coopEnv) DisplayLayer() int {
+	return e.StateLayer(e.observe(0))
+}
+
+func (e *coopEnv) render() RenderInfo {
+	info := RenderInfo{
+		Rows:     e.rows,
+		Cols:     e.cols,
+		Position: Position{Row: e.positions[0].row, Col: e.positions[0].col},
+		Door:     &Position{Row: e.door.row, Col: e.door.col},
+		DoorOpen: e.doorOpen(),
+	}
+	for i := range e.positions {
+		info.Agents = append(info.Agents, Position{Row: e.positions[i].row, Col: e.positions[i].col})
+		if !e.finished[i] {
+			info.Goals = append(info.Goals, e.goals[i])
+		}
+	}
+	for _, sw := range e.switches {
+		info.Switches = append(info.Switches, Position{Row: sw.row, Col: sw.col})
+	}
+	for r := 0; r < e.rows; r++ {
+		if r == e.door.row {
+			continue
+		}
+		info.Walls = append(info.Walls, Position{Row: r, Col: e.wallCol})
+	}
+	return info
+}
+
+func newCoopTrainer(cfg Config, rng *rand.Rand) *Trainer {
+	env := newCoopEnv(cfg.Rows, cfg.Cols, cfg.StepPenalty, cfg.MaxSteps)
+	cfg.Rows, cfg.Cols = env.rows, env.cols
+	cfg.Goals = []Goal{env.goals[0], env.goals[1]}
+	t := &Trainer{
+		cfg:             cfg,
+		baseStepPenalty: cfg.StepPenalty,
+		rng:             rng,
+		coop:            env,
+		shaper:          newRewardShaper(cfg),
+	}
+	for i := range t.coopQ {
+		t.coopQ[i] = newQTable(env.numStates(), 4)
+		t.coopQ[i].fill(optimisticValue(cfg))
+		t.coopAgents[i] = newEpsilonGreedyAgent(rng, nil, t.coopQ[i], cfg.Epsilon)
+		t.coopAgents[i].explore(cfg)
+	}
+	t.agent = t.coopAgents[0]
+	t.qvalues = t.coopQ[0]
+	return t
+}
+
+// parkedUpdate is the last transition of an agent that already reached its goal. It keeps collecting the
+// discounted team reward until the episode ends, so finishing early is credited with whether the partner
+// made it through too.
+type parkedUpdate struct {
+	state, action int
+	target        float64
+	discount      float64
+}
+
+// runCoopEpisode trains the two agents as independent Q-learners on the shared team reward.
+func (t *Trainer) runCoopEpisode(ctx context.Context, episode int, out chan<- Snapshot) {
+	env := t.coop
+	env.reset()
+	visits := t.resetEpisodeVisits(env.numStates())
+	var states, actions [coopAgents]int
+	var parked [coopAgents]*parkedUpdate
+	for i := range states {
+		states[i] = env.observe(i)
+		actions[i] = t.coopAgents[i].actInState(states[i])
+		visits[states[i]]++
+	}
+	steps := 0
+	episodeReward := 0.0
+	var lastReward float64
+	t.stepShaping, t.episodeShaping = 0, 0
+	var prevDistances [coopAgents]float64
+	for {
+		select {
+		case <-ctx.Done():
+			out <- t.snapshot(StatusCancelled, episode, steps, episodeReward, lastReward)
+			return
+		default:
+		}
+		wasFinished := env.finished
+		for i := range prevDistances {
+			prevDistances[i] = env.distance(i)
+		}
+		reward, done := env.step(actions)
+		episodeReward += reward
+		steps++
+		t.step++
+		lastReward = reward
+		t.stepShaping = 0
+		for i := range states {
+			if wasFinished[i] {
+				parked[i].target += parked[i].discount * reward
+				parked[i].discount *= t.cfg.Gamma
+				continue
+			}
+			// Each agent is shaped towards its own goal; like the count bonus, shaping only steers learning and
+			// the team reward reported per episode stays what the environment paid.
+			shaping := t.shaper.Shape(prevDistances[i], env.distance(i), env.finished[i])
+			t.stepShaping += shaping
+			learnReward := reward + shaping + t.countBonus(t.coopAgents[i], states[i], actions[i])
+			if env.finished[i] {
+				parked[i] = &parkedUpdate{state: states[i], action: actions[i], target: learnReward, discount: t.cfg.Gamma}
+				continue
+			}
+			next := env.observe(i)
+			var nextValue float64
+			if !done {
+				nextValue = t.coopQ[i].maxValue(next)
+			}
+			t.updateCoopQ(i, states[i], actions[i], learnReward+t.cfg.Gamma*nextValue)
+			states[i] = next
+			visits[next]++
+		}
+		t.episodeShaping += t.stepShaping
+		t.emitStep(out, episode, steps, episodeReward, reward)
+		if t.cfg.StepDelayMs > 0 {
+			select {
+			case <-ctx.Done():
+				out <- t.snapshot(StatusCancelled, episode, steps, episodeReward, reward)
+				return
+			case <-time.After(time.Duration(t.cfg.StepDelayMs) * time.Millisecond):
+			}
+		}
+		if done {
+			break
+		}
+		for i := range actions {
+			if !env.finished[i] {
+				actions[i] = t.coopAgents[i].actInState(states[i])
+			}
+		}
+	}
+	for i, p := range parked {
+		if p != nil {
+			t.updateCoopQ(i, p.state, p.action, p.target)
+		}
+	}
+	success := env.goalReached()
+	if success {
+		t.successCount++
+	}
+	t.totalReward += episodeReward
+	t.totalSteps += steps
+	t.episodesCompleted++
+	out <- t.episodeComplete(episode, steps, episodeReward, lastReward, success, visits)
+}
+
+func (t *Trainer) updateCoopQ(agent, state, action int, target float64) {
+	current := t.coopQ[agent].get(state, action)
+	t.coopQ[agent].set(state, action, current+t.stepSize(t.coopAgents[agent].qVisits, state, action)*(target-current))
+}
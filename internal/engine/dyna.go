@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"math"
+	"math/rand"
+)
+
+type modelTransition struct {
+	reward   float64
+	next     int
+	done     bool
+	lastStep int
+}
+
+// dynaModel is the deterministic last-seen model used for Dyna-style planning.
+type dynaModel struct {
+	actions     int
+	transitions map[actionKey]modelTransition
+	keys        []actionKey
+	seenStates  map[int]bool
+}
+
+func newDynaModel(actions int) *dynaModel {
+	return &dynaModel{
+		actions:     actions,
+		transitions: make(map[actionKey]modelTransition),
+		seenStates:  make(map[int]bool),
+	}
+}
+
+// record stores the latest outcome of (state, action). When seedUntried is set, the first visit to a state
+// also models every other action as a zero-reward self-loop so Dyna-Q+ can plan towards untested moves.
+func (m *dynaModel) record(state, action int, reward float64, next int, done bool, step int, seedUntried bool) {
+	if seedUntried && !m.seenStates[state] {
+		for a := 0; a < m.actions; a++ {
+			if a == action {
+				continue
+			}
+			m.put(actionKey{state: state, action: a}, modelTransition{next: state})
+		}
+	}
+	m.seenStates[state] = true
+	m.put(actionKey{state: state, action: action}, modelTransition{
+		reward:   reward,
+		next:     next,
+		done:     done,
+		lastStep: step,
+	})
+}
+
+func (m *dynaModel) put(key actionKey, transition modelTransition) {
+	if _, ok := m.transitions[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.transitions[key] = transition
+}
+
+func (m *dynaModel) sample(rng *rand.Rand) (actionKey, modelTransition, bool) {
+	if len(m.keys) == 0 {
+		return actionKey{}, modelTransition{}, false
+	}
+	key := m.keys[rng.Intn(len(m.keys))]
+	return key, m.transitions[key], true
+}
+
+// explorationBonus is the Dyna-Q+ reward bonus κ·√τ for a transition last tried τ steps ago.
+func explorationBonus(kappa float64, now, lastStep int) float64 {
+	if kappa <= 0 || now <= lastStep {
+		return 0
+	}
+	return kappa * math.Sqrt(float64(now-lastStep))
+}
@@ -0,0 +1,80 @@
+package engine
+
+import "math/rand"
+
+const (
+	EnvGridworld = "gridworld"
+	EnvCoop      = "coop"
+)
+
+// DefaultBoardSize is the board a zero Rows or Cols selects in env. The coop board needs five columns to
+// fit a switch on either side of its wall, so it is a column wider than the gridworld.
+func DefaultBoardSize(env string) (rows, cols int) {
+	if env == EnvCoop {
+		return 4, 5
+	}
+	return 4, 4
+}
+
+// Environment is a discrete, episodic task the Trainer can learn in. States and actions are dense ids so
+// tabular learners can index them directly.
+type Environment interface {
+	// Reset starts a new episode.
+	Reset()
+	// Step applies action and returns the reward and whether the episode ended.
+	Step(action int) (float64, bool)
+	// State returns the id of the current state in [0, NumStates).
+	State() int
+	NumStates() int
+	NumActions() int
+	// GoalReached reports whether the episode ended by completing the task rather than timing out.
+	GoalReached() bool
+	// StatePosition maps a state id to the grid cell used to draw it.
+	StatePosition(state int) Position
+	// Render describes the current layout for snapshots and visualisation.
+	Render() RenderInfo
+}
+
+// CloneableEnvironment is implemented by custom environments that can copy themselves. Evaluate rolls out
+// greedy episodes on a clone, so periodic evaluation only runs on custom environments that implement it.
+type CloneableEnvironment interface {
+	Environment
+	// Clone returns an independent copy; stepping it must leave the original untouched.
+	Clone() Environment
+}
+
+// RenderInfo is the drawable view of an environment. Multi-agent environments also fill Agents,
+// Switches and the door state.
+type RenderInfo struct {
+	Rows     int
+	Cols     int
+	Position Position
+	Goals    []Goal
+	Walls    []Position
+	Slips    []SlipTile
+	Agents   []Position
+	Switches []Position
+	Door     *Position
+	DoorOpen bool
+}
+
+// stateProjector maps state ids onto grid cells for value maps and visit heatmaps.
+type stateProjector interface {
+	StatePosition(state int) Position
+}
+
+// potentialEnvironment is implemented by environments that provide a distance-to-goal potential for shaping.
+type potentialEnvironment interface {
+	Potential() float64
+}
+
+// layeredEnvironment is implemented by environments whose state ids stack several layers over the same
+// cells. Value maps project only the display layer instead of mixing layers together.
+type layeredEnvironment interface {
+	StateLayer(state int) int
+	DisplayLayer() int
+}
+
+func newEnvironment(cfg Config, rng *rand.Rand) Environment {
+	return newConfiguredGridworld(cfg, rng)
+}
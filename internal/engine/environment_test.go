@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"testing"
+)
+
+// chainEnv is a one-dimensional corridor: action 1 moves right, anything else moves left, and the last
+// cell ends the episode with a reward.
+type chainEnv struct {
+	length int
+	pos    int
+	steps  int
+}
+
+func (c *chainEnv) Reset() {
+	c.pos = 0
+	c.steps = 0
+}
+
+func (c *chainEnv) Step(action int) (float64, bool) {
+	c.steps++
+	if action == 1 {
+		c.pos++
+	} else if c.pos > 0 {
+		c.pos--
+	}
+	if c.pos == c.length-1 {
+		return 1, true
+	}
+	return 0, c.steps >= 50
+}
+
+func (c *chainEnv) State() int                       { return c.pos }
+func (c *chainEnv) NumStates() int                   { return c.length }
+func (c *chainEnv) NumActions() int                  { return 2 }
+func (c *chainEnv) GoalReached() bool                { return c.pos == c.length-1 }
+func (c *chainEnv) StatePosition(state int) Position { return Position{Row: 0, Col: state} }
+
+func (c *chainEnv) Render() RenderInfo {
+	return RenderInfo{
+		Rows:     1,
+		Cols:     c.length,
+		Position: Position{Row: 0, Col: c.pos},
+		Goals:    []Goal{{Row: 0, Col: c.length - 1, Reward: 1}},
+	}
+}
+
+func TestTrainerWithCustomEnvironment(t *testing.T) {
+	cfg := Config{
+		Episodes:  30,
+		Seed:      5,
+		Algorithm: AlgorithmQLearning,
+		Epsilon:   0.2,
+		Alpha:     0.5,
+		Gamma:     0.9,
+	}
+	env := &chainEnv{length: 6}
+
+	trainer := NewTrainerWithEnvironment(cfg, env)
+	var final Snapshot
+	for snapshot := range trainer.Run(context.Background()) {
+		final = snapshot
+	}
+
+	if final.EpisodesCompleted != cfg.Episodes {
+		t.Fatalf("expected %d episodes completed, got %d", cfg.Episodes, final.EpisodesCompleted)
+	}
+	if final.SuccessCount < cfg.Episodes/2 {
+		t.Fatalf("expected most episodes to reach the end of the chain, got %d", final.SuccessCount)
+	}
+	if len(final.ValueMap) != 1 || len(final.ValueMap[0]) != env.length {
+		t.Fatalf("expected a 1x%d value map, got %dx%d", env.length, len(final.ValueMap), len(final.ValueMap[0]))
+	}
+	if final.ValueMap[0][env.length-2] <= final.ValueMap[0][0] {
+		t.Fatalf("expected values to rise towards the goal: %v", final.ValueMap[0])
+	}
+}
+
+// countingEnv counts the steps taken on this very value, so a test can tell training steps from
+// evaluation steps taken on a copy.
+type countingEnv struct {
+	chainEnv
+	calls int
+}
+
+func (c *countingEnv) Step(action int) (float64, bool) {
+	c.calls++
+	return c.chainEnv.Step(action)
+}
+
+type cloneableCountingEnv struct{ countingEnv }
+
+func (c *cloneableCountingEnv) Clone() Environment {
+	clone := *c
+	return &clone
+}
+
+func TestPeriodicEvaluationLeavesCustomEnvironmentsAlone(t *testing.T) {
+	cfg := Config{Episodes: 10, Seed: 5, Algorithm: AlgorithmQLearning, Epsilon: 0.2, Alpha: 0.5, Gamma: 0.9, EvalEvery: 2, EvalEpisodes: 3}
+	run := func(env Environment, calls *int) {
+		trainer := NewTrainerWithEnvironment(cfg, env)
+		evaluations, trainingSteps := 0, 0
+		for snapshot := range trainer.Run(context.Background()) {
+			switch snapshot.Status {
+			case StatusEvaluation:
+				evaluations++
+			case StatusEpisodeComplete:
+				trainingSteps += snapshot.EpisodeSteps
+			}
+		}
+		if *calls != trainingSteps {
+			t.Fatalf("%T: expected only the %d training steps on the live environment, got %d", env, trainingSteps, *calls)
+		}
+		// Environments that cannot be copied skip periodic evaluation instead of being stepped mid-run.
+		want := 0
+		if _, ok := env.(CloneableEnvironment); ok {
+			want = cfg.Episodes / cfg.EvalEvery
+		}
+		if evaluations != want {
+			t.Fatalf("%T: expected %d evaluations, got %d", env, want, evaluations)
+		}
+	}
+	plain := &countingEnv{chainEnv: chainEnv{length: 6}}
+	run(plain, &plain.calls)
+	cloneable := &cloneableCountingEnv{countingEnv{chainEnv: chainEnv{length: 6}}}
+	run(cloneable, &cloneable.calls)
+}
@@ -0,0 +1,149 @@
+package engine
+
+import "math/rand"
+
+// Evaluation summarizes greedy (ε=0) rollouts of the current Q-tables. Returns are undiscounted
+// environment rewards without distance shaping; the CI fields are half-widths of 95% confidence intervals.
+type Evaluation struct {
+	Episodes    int
+	MeanReturn  float64
+	ReturnCI    float64
+	MeanSteps   float64
+	StepsCI     float64
+	SuccessRate float64
+	SuccessCI   float64
+	// Layout is the board the rollouts ran on, for rendering trajectories.
+	Layout RenderInfo
+	Runs   []EvalEpisode
+}
+
+// EvalEpisode is one greedy rollout. Paths holds one cell sequence per agent, starting at its start cell.
+type EvalEpisode struct {
+	Return  float64
+	Steps   int
+	Success bool
+	Paths   [][]Position
+}
+
+// Evaluate runs episodes greedy rollouts on a copy of the training board. It reads the Q-tables but
+// never updates them, the visit counters or the training random stream; seed drives slips and ties.
+// Custom environments passed to NewTrainerWithEnvironment are copied if they implement
+// CloneableEnvironment; otherwise they are reset and stepped directly, so call Evaluate between runs.
+func (t *Trainer) Evaluate(episodes int, seed int64) *Evaluation {
+	if episodes <= 0 {
+		episodes = 1
+	}
+	rng := newTrainerRand(seed)
+	eval := &Evaluation{Episodes: episodes, Runs: make([]EvalEpisode, 0, episodes)}
+	if t.coop != nil {
+		env := *t.coop
+		env.reset()
+		eval.Layout = env.render()
+		for i := 0; i < episodes; i++ {
+			eval.Runs = append(eval.Runs, t.evaluateCoopEpisode(&env, rng))
+		}
+	} else {
+		env := t.env
+		if t.grid != nil {
+			grid := t.grid.clone(rng)
+			grid.setStepPenalty(t.baseStepPenalty)
+			env = grid
+		} else if cloneable, ok := t.env.(CloneableEnvironment); ok {
+			env = cloneable.Clone()
+		}
+		env.Reset()
+		eval.Layout = env.Render()
+		for i := 0; i < episodes; i++ {
+			eval.Runs = append(eval.Runs, t.evaluateEpisode(env, rng))
+		}
+	}
+	returns := make([]float64, len(eval.Runs))
+	steps := make([]float64, len(eval.Runs))
+	successes := make([]float64, len(eval.Runs))
+	for i, run := range eval.Runs {
+		returns[i] = run.Return
+		steps[i] = float64(run.Steps)
+		if run.Success {
+			successes[i] = 1
+		}
+	}
+	eval.MeanReturn, eval.ReturnCI = meanCI95(returns)
+	eval.MeanSteps, eval.StepsCI = meanCI95(steps)
+	eval.SuccessRate, eval.SuccessCI = meanCI95(successes)
+	return eval
+}
+
+func (t *Trainer) evaluateEpisode(env Environment, rng *rand.Rand) EvalEpisode {
+	env.Reset()
+	state := env.State()
+	path := []Position{env.StatePosition(state)}
+	var run EvalEpisode
+	for {
+		reward, done := env.Step(greedyAction(t.qvalues, state, rng))
+		state = env.State()
+		run.Return += reward
+		run.Steps++
+		path = append(path, env.StatePosition(state))
+		if done {
+			run.Success = env.GoalReached()
+			break
+		}
+	}
+	run.Paths = [][]Position{path}
+	return run
+}
+
+func (t *Trainer) evaluateCoopEpisode(env *coopEnv, rng *rand.Rand) EvalEpisode {
+	env.reset()
+	var run EvalEpisode
+	run.Paths = make([][]Position, coopAgents)
+	for i, pos := range env.positions {
+		run.Paths[i] = []Position{{Row: pos.row, Col: pos.col}}
+	}
+	for {
+		var actions [coopAgents]int
+		for i := range actions {
+			if !env.finished[i] {
+				actions[i] = greedyAction(t.coopQ[i], env.observe(i), rng)
+			}
+		}
+		reward, done := env.step(actions)
+		run.Return += reward
+		run.Steps++
+		for i, pos := range env.positions {
+			run.Paths[i] = append(run.Paths[i], Position{Row: pos.row, Col: pos.col})
+		}
+		if done {
+			run.Success = env.goalReached()
+			break
+		}
+	}
+	return run
+}
+
+// canEvaluateDuringTraining reports whether Evaluate leaves the training environment alone, which
+// periodic evaluation inside Run needs.
+func (t *Trainer) canEvaluateDuringTraining() bool {
+	if t.coop != nil || t.grid != nil {
+		return true
+	}
+	_, ok := t.env.(CloneableEnvironment)
+	return ok
+}
+
+// greedyAction picks the highest-valued action, breaking ties uniformly with rng.
+func greedyAction(q *qTable, state int, rng *rand.Rand) int {
+	best := q.maxValue(state)
+	ties := 0
+	choice := 0
+	for action := 0; action < q.actions; action++ {
+		if q.get(state, action) != best {
+			continue
+		}
+		ties++
+		if rng.Intn(ties) == 0 {
+			choice = action
+		}
+	}
+	return choice
+}
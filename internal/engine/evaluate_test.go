@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestEvaluateIsGreedyAndLeavesTrainingStateAlone(t *testing.T) {
+	cfg := Config{
+		Episodes:     200,
+		Seed:         4,
+		Algorithm:    AlgorithmQLearning,
+		Rows:         4,
+		Cols:         4,
+		Epsilon:      0.3,
+		EpsilonMin:   0.05,
+		EpsilonDecay: 0.98,
+		Alpha:        0.5,
+		Gamma:        0.9,
+		StepPenalty:  0.02,
+		Walls:        []Position{{Row: 1, Col: 1}},
+	}
+	trainer := NewTrainer(cfg)
+	for range trainer.Run(context.Background()) {
+	}
+
+	before := trainer.Checkpoint()
+	eval := trainer.Evaluate(20, 9)
+	after := trainer.Checkpoint()
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("expected evaluation to leave Q-values, visits, counters and the training RNG untouched")
+	}
+
+	if eval.Episodes != 20 || len(eval.Runs) != 20 {
+		t.Fatalf("expected 20 evaluation runs, got %d", len(eval.Runs))
+	}
+	if eval.SuccessRate != 1 {
+		t.Fatalf("expected the greedy policy to reach the goal every time on a deterministic board, got %.2f", eval.SuccessRate)
+	}
+	if eval.ReturnCI > 1e-9 || eval.StepsCI > 1e-9 {
+		t.Fatalf("expected identical deterministic rollouts to have zero-width intervals")
+	}
+	path := eval.Runs[0].Paths[0]
+	if len(path) != eval.Runs[0].Steps+1 {
+		t.Fatalf("expected the trajectory to hold the start cell plus one cell per step")
+	}
+	for _, pos := range path {
+		if pos == (Position{Row: 1, Col: 1}) {
+			t.Fatalf("expected the trajectory to avoid the wall")
+		}
+	}
+}
+
+func TestMeanCI95(t *testing.T) {
+	mean, half := meanCI95([]float64{1, 2, 3, 4})
+	if mean != 2.5 {
+		t.Fatalf("expected mean 2.5, got %.3f", mean)
+	}
+	// sample stddev is sqrt(5/3); half-width is t(3) * sd / 2
+	if want := 3.182 * 1.2909944487358056 / 2; half < want-1e-9 || half > want+1e-9 {
+		t.Fatalf("expected half-width %.6f, got %.6f", want, half)
+	}
+	if _, half := meanCI95([]float64{7}); half != 0 {
+		t.Fatalf("expected a single sample to have zero half-width")
+	}
+}
+
+func TestPeriodicEvaluationDoesNotChangeTraining(t *testing.T) {
+	cfg := Config{
+		Episodes:     30,
+		Seed:         6,
+		Algorithm:    AlgorithmSARSA,
+		Rows:         4,
+		Cols:         4,
+		Epsilon:      0.4,
+		EpsilonDecay: 0.95,
+		Alpha:        0.3,
+		Gamma:        0.9,
+		StepPenalty:  0.02,
+		Slips:        []SlipTile{{Row: 2, Col: 1, Probability: 0.5}},
+	}
+	plain := NewTrainer(cfg)
+	for range plain.Run(context.Background()) {
+	}
+
+	cfg.EvalEvery = 10
+	cfg.EvalEpisodes = 4
+	evaluated := NewTrainer(cfg)
+	var evaluations []Snapshot
+	for snapshot := range evaluated.Run(context.Background()) {
+		if snapshot.Status == StatusEvaluation {
+			evaluations = append(evaluations, snapshot)
+		}
+	}
+
+	if len(evaluations) != 3 {
+		t.Fatalf("expected an evaluation after episodes 10, 20 and 30, got %d", len(evaluations))
+	}
+	for i, snapshot := range evaluations {
+		if snapshot.Episode != (i+1)*10 || snapshot.Evaluation == nil || snapshot.Evaluation.Episodes != 4 {
+			t.Fatalf("unexpected evaluation snapshot %d: episode=%d", i, snapshot.Episode)
+		}
+	}
+	want, got := plain.Checkpoint(), evaluated.Checkpoint()
+	if !reflect.DeepEqual(want.QValues, got.QValues) || want.RNG != got.RNG || want.TotalReward != got.TotalReward {
+		t.Fatalf("expected interleaved evaluation to leave the training run unchanged")
+	}
+}
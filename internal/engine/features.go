@@ -3,7 +3,7 @@ package engine
 // FeatureMapper describes how to map a grid position to a feature index used by value-based learners.
 type FeatureMapper interface {
 	NumFeatures(rows, cols int) int
-	Index(env *gridworldEnv, row, col int) int
+	Index(env Environment, row, col int) int
 }
 
 // DistanceBands3Mapper replicates the current three-band distance heuristic.
@@ -17,11 +17,11 @@ func (DistanceBands3Mapper) NumFeatures(rows, cols int) int {
 }
 
 // Index computes which distance band contains the provided cell.
-func (DistanceBands3Mapper) Index(env *gridworldEnv, row, col int) int {
+func (DistanceBands3Mapper) Index(env Environment, row, col int) int {
 	if env == nil {
 		return 0
 	}
-	distance := env.potential(row, col)
+	distance := goalDistance(env, row, col)
 	switch {
 	case distance <= 1:
 		return 0
@@ -48,11 +48,11 @@ func (m DistanceBandsMapper) NumFeatures(rows, cols int) int {
 }
 
 // Index assigns the cell to the first threshold that is at least as large as the current potential.
-func (m DistanceBandsMapper) Index(env *gridworldEnv, row, col int) int {
+func (m DistanceBandsMapper) Index(env Environment, row, col int) int {
 	if env == nil {
 		return 0
 	}
-	distance := env.potential(row, col)
+	distance := goalDistance(env, row, col)
 	for i, limit := range m.Thresholds {
 		if distance <= limit {
 			return i
@@ -60,3 +60,8 @@ func (m DistanceBandsMapper) Index(env *gridworldEnv, row, col int) int {
 	}
 	return len(m.Thresholds)
 }
+
+func goalDistance(env Environment, row, col int) float64 {
+	info := env.Render()
+	return nearestGoalDistance(info.Goals, info.Rows, info.Cols, row, col)
+}
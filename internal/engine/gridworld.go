@@ -15,6 +15,8 @@ type gridworldEnv struct {
 	stepPenalty  float64
 	tiles        map[position]tile
 	rng          *rand.Rand
+	goalBits     int
+	collected    int
 }
 
 type tileKind int
@@ -32,6 +34,10 @@ type tile struct {
 
 const timeoutPenaltyMultiplier = 5.0
 
+// maxGoalStateBits caps how many goals contribute a collected bit to the state id; later goals are
+// still collectable but invisible to the learner, keeping the table at most 256 layers deep.
+const maxGoalStateBits = 8
+
 func newGridworldEnv(rows, cols int, goals []Goal, stepPenalty float64, overrideMaxSteps int) *gridworldEnv {
 	if rows <= 0 {
 		rows = 1
@@ -72,16 +78,58 @@ func newGridworldEnv(rows, cols int, goals []Goal, stepPenalty float64, override
 	}
 }
 
-func (g *gridworldEnv) reset() {
+func newConfiguredGridworld(cfg Config, rng *rand.Rand) *gridworldEnv {
+	env := newGridworldEnv(cfg.Rows, cfg.Cols, cfg.Goals, cfg.StepPenalty, cfg.MaxSteps)
+	env.setRandomSource(rng)
+	for _, wall := range cfg.Walls {
+		env.setWall(wall.Row, wall.Col)
+	}
+	for _, slip := range cfg.Slips {
+		env.setSlipTile(slip.Row, slip.Col, slip.Probability)
+	}
+	if cfg.GoalAwareState {
+		env.enableGoalState()
+	}
+	return env
+}
+
+// enableGoalState stacks one grid layer per combination of collected goals, so the learner can tell
+// "goal A still present" from "goal A already eaten".
+func (g *gridworldEnv) enableGoalState() {
+	bits := len(g.initialGoals)
+	if bits > maxGoalStateBits {
+		bits = maxGoalStateBits
+	}
+	g.goalBits = bits
+}
+
+// clone copies the current layout, including switched walls and reshuffled goals, onto an independent
+// board driven by rng so evaluation never touches the training environment or its random stream.
+func (g *gridworldEnv) clone(rng *rand.Rand) *gridworldEnv {
+	c := *g
+	c.goals = cloneGoalSlice(g.goals)
+	c.initialGoals = cloneGoalSlice(g.initialGoals)
+	c.tiles = make(map[position]tile, len(g.tiles))
+	for pos, t := range g.tiles {
+		c.tiles[pos] = t
+	}
+	c.rng = rng
+	c.Reset()
+	return &c
+}
+
+func (g *gridworldEnv) Reset() {
 	g.currRow = g.startRow
 	g.currCol = g.startCol
 	g.stepsTaken = 0
 	g.goals = cloneGoalSlice(g.initialGoals)
+	g.collected = 0
 }
 
 func (g *gridworldEnv) setGoals(goals []Goal) {
 	g.initialGoals = cloneGoalSlice(goals)
 	g.goals = cloneGoalSlice(goals)
+	g.collected = 0
 }
 
 func (g *gridworldEnv) setStepPenalty(p float64) {
@@ -105,6 +153,14 @@ func (g *gridworldEnv) setWall(row, col int) {
 	g.tiles[position{row: row, col: col}] = tile{kind: tileWall}
 }
 
+func (g *gridworldEnv) clearWalls() {
+	for pos, t := range g.tiles {
+		if t.kind == tileWall {
+			delete(g.tiles, pos)
+		}
+	}
+}
+
 func (g *gridworldEnv) setSlipTile(row, col int, probability float64) {
 	if row < 0 || row >= g.rows || col < 0 || col >= g.cols {
 		return
@@ -165,7 +221,61 @@ func (g *gridworldEnv) slipTiles() []SlipTile {
 	return tiles
 }
 
-func (g *gridworldEnv) step(action int) (float64, bool) {
+func (g *gridworldEnv) State() int {
+	return g.collected*g.rows*g.cols + g.stateAt(g.currRow, g.currCol)
+}
+
+// stateAt returns the id of a cell on the layer where no goal has been collected yet.
+func (g *gridworldEnv) stateAt(row, col int) int {
+	return row*g.cols + col
+}
+
+func (g *gridworldEnv) NumStates() int {
+	return g.rows * g.cols << g.goalBits
+}
+
+func (g *gridworldEnv) NumActions() int {
+	return 4
+}
+
+func (g *gridworldEnv) GoalReached() bool {
+	return len(g.goals) == 0
+}
+
+func (g *gridworldEnv) StatePosition(state int) Position {
+	cell := state % (g.rows * g.cols)
+	return Position{Row: cell / g.cols, Col: cell % g.cols}
+}
+
+func (g *gridworldEnv) StateLayer(state int) int {
+	return state / (g.rows * g.cols)
+}
+
+// DisplayLayer shows the current collected-goal layer mid-episode and falls back to the fresh board
+// once every goal is gone, since the all-collected layer is terminal and never learned.
+func (g *gridworldEnv) DisplayLayer() int {
+	if len(g.goals) == 0 {
+		return 0
+	}
+	return g.collected
+}
+
+func (g *gridworldEnv) Render() RenderInfo {
+	return RenderInfo{
+		Rows:     g.rows,
+		Cols:     g.cols,
+		Position: Position{Row: g.currRow, Col: g.currCol},
+		Goals:    cloneGoals(g.goals),
+		Walls:    clonePositions(g.wallPositions()),
+		Slips:    cloneSlips(g.slipTiles()),
+	}
+}
+
+func (g *gridworldEnv) Potential() float64 {
+	return g.potential(g.currRow, g.currCol)
+}
+
+func (g *gridworldEnv) Step(action int) (float64, bool) {
 	if g.stepsTaken >= g.maxSteps {
 		return 0, true
 	}
@@ -183,6 +293,7 @@ func (g *gridworldEnv) step(action int) (float64, bool) {
 		if g.currRow == goal.Row && g.currCol == goal.Col {
 			reward += goal.Reward
 			g.goals = append(g.goals[:i], g.goals[i+1:]...)
+			g.markCollected(goal)
 			collected = true
 			break
 		}
@@ -197,8 +308,25 @@ func (g *gridworldEnv) step(action int) (float64, bool) {
 	return reward, false
 }
 
+func (g *gridworldEnv) markCollected(goal Goal) {
+	for i := 0; i < g.goalBits; i++ {
+		initial := g.initialGoals[i]
+		if g.collected&(1<<i) == 0 && initial.Row == goal.Row && initial.Col == goal.Col {
+			g.collected |= 1 << i
+			return
+		}
+	}
+}
+
 func (g *gridworldEnv) nextPosition(action int) (int, int) {
-	row, col := g.currRow, g.currCol
+	return g.positionAfter(g.currRow, g.currCol, action)
+}
+
+func (g *gridworldEnv) positionAfter(row, col, action int) (int, int) {
+	return moveWithinBounds(g.rows, g.cols, row, col, action)
+}
+
+func moveWithinBounds(rows, cols, row, col, action int) (int, int) {
 	switch action {
 	case 0:
 		row--
@@ -212,24 +340,28 @@ func (g *gridworldEnv) nextPosition(action int) (int, int) {
 	if row < 0 {
 		row = 0
 	}
-	if row >= g.rows {
-		row = g.rows - 1
+	if row >= rows {
+		row = rows - 1
 	}
 	if col < 0 {
 		col = 0
 	}
-	if col >= g.cols {
-		col = g.cols - 1
+	if col >= cols {
+		col = cols - 1
 	}
 	return row, col
 }
 
 func (g *gridworldEnv) potential(row, col int) float64 {
-	if len(g.goals) == 0 {
+	return nearestGoalDistance(g.goals, g.rows, g.cols, row, col)
+}
+
+func nearestGoalDistance(goals []Goal, rows, cols, row, col int) float64 {
+	if len(goals) == 0 {
 		return 0
 	}
-	minDist := g.rows + g.cols
-	for _, goal := range g.goals {
+	minDist := rows + cols
+	for _, goal := range goals {
 		d := absInt(goal.Row-row) + absInt(goal.Col-col)
 		if d < minDist {
 			minDist = d
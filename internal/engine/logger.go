@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LogLevel orders trainer log messages by severity.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "debug"
+	case LogInfo:
+		return "info"
+	case LogWarn:
+		return "warn"
+	case LogError:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// ParseLogLevel accepts debug, info, warn or error.
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level := LogDebug; level <= LogError; level++ {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", name)
+}
+
+// Logger receives the trainer's diagnostic messages. The engine never writes to stdout itself; hosts
+// decide where messages go.
+type Logger interface {
+	Log(level LogLevel, msg string)
+}
+
+// LoggerFunc adapts a plain function to Logger.
+type LoggerFunc func(level LogLevel, msg string)
+
+func (f LoggerFunc) Log(level LogLevel, msg string) {
+	f(level, msg)
+}
+
+// SetLogger routes messages at min or above to logger. A nil logger, the default, silences the trainer.
+// Call it before Run.
+func (t *Trainer) SetLogger(logger Logger, min LogLevel) {
+	t.logger = logger
+	t.logLevel = min
+}
+
+func (t *Trainer) logf(level LogLevel, format string, args ...any) {
+	if t.logger == nil || level < t.logLevel {
+		return
+	}
+	t.logger.Log(level, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,40 @@
+package engine
+
+// nStepBuffer holds the last n+1 states and actions of an episode and the rewards that followed them,
+// indexed by time step modulo n+1: reward(i) is R_i, received after the action at step i-1.
+type nStepBuffer struct {
+	n       int
+	states  []int
+	actions []int
+	rewards []float64
+}
+
+func newNStepBuffer(n int) *nStepBuffer {
+	return &nStepBuffer{
+		n:       n,
+		states:  make([]int, n+1),
+		actions: make([]int, n+1),
+		rewards: make([]float64, n+1),
+	}
+}
+
+func (b *nStepBuffer) store(step, state, action int) {
+	b.states[step%(b.n+1)] = state
+	b.actions[step%(b.n+1)] = action
+}
+
+func (b *nStepBuffer) storeReward(step int, reward float64) {
+	b.rewards[step%(b.n+1)] = reward
+}
+
+func (b *nStepBuffer) state(step int) int {
+	return b.states[step%(b.n+1)]
+}
+
+func (b *nStepBuffer) action(step int) int {
+	return b.actions[step%(b.n+1)]
+}
+
+func (b *nStepBuffer) reward(step int) float64 {
+	return b.rewards[step%(b.n+1)]
+}
@@ -1,48 +1,141 @@
 package engine
 
+import "math"
+
+// qTable stores Q(s, a) row-major in one flat slice, so the values of state s are
+// data[s*actions : (s+1)*actions] and lookups never chase per-state pointers.
 type qTable struct {
-	rows    int
-	cols    int
+	states  int
 	actions int
-	data    [][][]float64
+	data    []float64
+}
+
+func newQTable(states, actions int) *qTable {
+	return &qTable{states: states, actions: actions, data: make([]float64, states*actions)}
+}
+
+func (q *qTable) row(state int) []float64 {
+	start := state * q.actions
+	return q.data[start : start+q.actions]
+}
+
+func (q *qTable) get(state, action int) float64 {
+	return q.data[state*q.actions+action]
+}
+
+func (q *qTable) set(state, action int, value float64) {
+	q.data[state*q.actions+action] = value
 }
 
-func newQTable(rows, cols, actions int) *qTable {
-	data := make([][][]float64, rows)
-	for r := 0; r < rows; r++ {
-		data[r] = make([][]float64, cols)
-		for c := 0; c < cols; c++ {
-			data[r][c] = make([]float64, actions)
+func (q *qTable) maxValue(state int) float64 {
+	row := q.row(state)
+	max := row[0]
+	for _, value := range row[1:] {
+		if value > max {
+			max = value
 		}
 	}
-	return &qTable{rows: rows, cols: cols, actions: actions, data: data}
+	return max
 }
 
-func (q *qTable) get(row, col, action int) float64 {
-	return q.data[row][col][action]
+func (q *qTable) argmax(state int) int {
+	row := q.row(state)
+	best := 0
+	for a := 1; a < len(row); a++ {
+		if row[a] > row[best] {
+			best = a
+		}
+	}
+	return best
 }
 
-func (q *qTable) set(row, col, action int, value float64) {
-	q.data[row][col][action] = value
+func (q *qTable) isGreedy(state, action int) bool {
+	return q.get(state, action) >= q.maxValue(state)
 }
 
-func (q *qTable) maxValue(row, col int) float64 {
-	max := q.data[row][col][0]
-	for a := 1; a < q.actions; a++ {
-		if q.data[row][col][a] > max {
-			max = q.data[row][col][a]
+// greedyProbability is the probability a greedy policy that splits ties evenly picks action in state.
+func (q *qTable) greedyProbability(state, action int) float64 {
+	best := q.maxValue(state)
+	if q.get(state, action) < best {
+		return 0
+	}
+	ties := 0
+	for _, value := range q.row(state) {
+		if value == best {
+			ties++
 		}
 	}
-	return max
+	return 1 / float64(ties)
 }
 
-func (q *qTable) stateValues() [][]float64 {
-	values := make([][]float64, q.rows)
-	for r := 0; r < q.rows; r++ {
-		values[r] = make([]float64, q.cols)
-		for c := 0; c < q.cols; c++ {
-			values[r][c] = q.maxValue(r, c)
+// fill sets every Q-value to value.
+func (q *qTable) fill(value float64) {
+	for i := range q.data {
+		q.data[i] = value
+	}
+}
+
+// rows copies the table out as one slice per state, the layout checkpoints use.
+func (q *qTable) rows() [][]float64 {
+	out := make([][]float64, q.states)
+	for s := range out {
+		out[s] = append([]float64(nil), q.row(s)...)
+	}
+	return out
+}
+
+// visitTable counts how often each (state, action) pair was chosen, in the same flat layout as qTable.
+type visitTable struct {
+	actions int
+	counts  []int
+}
+
+func newVisitTable(states, actions int) *visitTable {
+	return &visitTable{actions: actions, counts: make([]int, states*actions)}
+}
+
+func (v *visitTable) get(state, action int) int {
+	return v.counts[state*v.actions+action]
+}
+
+func (v *visitTable) inc(state, action int) {
+	v.counts[state*v.actions+action]++
+}
+
+func (v *visitTable) reset() {
+	clear(v.counts)
+}
+
+// stateValues projects max-Q onto the rows×cols grid; cells shared by several states keep the best value.
+// Layered environments only contribute states from their display layer.
+func (q *qTable) stateValues(env stateProjector, rows, cols int) [][]float64 {
+	layered, hasLayers := env.(layeredEnvironment)
+	displayLayer := 0
+	if hasLayers {
+		displayLayer = layered.DisplayLayer()
+	}
+	// Running snapshots build this map every step, so the rows share one backing slice.
+	cells := make([]float64, rows*cols)
+	values := make([][]float64, rows)
+	for r := range values {
+		values[r] = cells[r*cols : (r+1)*cols : (r+1)*cols]
+	}
+	seen := make([]bool, rows*cols)
+	for s := 0; s < q.states; s++ {
+		if hasLayers && layered.StateLayer(s) != displayLayer {
+			continue
+		}
+		pos := env.StatePosition(s)
+		if pos.Row < 0 || pos.Row >= rows || pos.Col < 0 || pos.Col >= cols {
+			continue
+		}
+		v, cell := q.maxValue(s), pos.Row*cols+pos.Col
+		if !seen[cell] {
+			cells[cell] = v
+			seen[cell] = true
+			continue
 		}
+		cells[cell] = math.Max(cells[cell], v)
 	}
 	return values
 }
@@ -0,0 +1,148 @@
+package engine
+
+import (
+	"context"
+	"sync"
+)
+
+// EpisodeRecord is the outcome of one training episode.
+type EpisodeRecord struct {
+	Reward  float64
+	Steps   int
+	Success bool
+}
+
+// RunResult holds the per-episode outcomes of one complete training run.
+type RunResult struct {
+	Config   Config
+	Episodes []EpisodeRecord
+}
+
+// Window returns the mean episode reward and success rate over the last n episodes (all of them when
+// n is zero or exceeds the run length).
+func (r RunResult) Window(n int) (meanReward, successRate float64) {
+	episodes := r.Episodes
+	if n > 0 && n < len(episodes) {
+		episodes = episodes[len(episodes)-n:]
+	}
+	if len(episodes) == 0 {
+		return 0, 0
+	}
+	for _, ep := range episodes {
+		meanReward += ep.Reward
+		if ep.Success {
+			successRate++
+		}
+	}
+	count := float64(len(episodes))
+	return meanReward / count, successRate / count
+}
+
+// Train runs cfg to completion on a fresh Trainer and records every episode.
+func Train(ctx context.Context, cfg Config) RunResult {
+	// Only episode outcomes are recorded, so skip the per-step snapshots entirely.
+	quiet := cfg
+	quiet.SnapshotPolicy = SnapshotEpisodeEnd
+	quiet.StepEvents = false
+	trainer := NewTrainer(quiet)
+	result := RunResult{Config: cfg}
+	lastSuccess := 0
+	for snapshot := range trainer.Run(ctx) {
+		if snapshot.Status != StatusEpisodeComplete {
+			continue
+		}
+		result.Episodes = append(result.Episodes, EpisodeRecord{
+			Reward:  snapshot.EpisodeReward,
+			Steps:   snapshot.EpisodeSteps,
+			Success: snapshot.SuccessCount > lastSuccess,
+		})
+		lastSuccess = snapshot.SuccessCount
+	}
+	return result
+}
+
+// TrainAll trains every configuration on its own Trainer using at most workers goroutines and returns
+// the results in input order. Trainers share nothing, so results match running each config alone.
+func TrainAll(ctx context.Context, cfgs []Config, workers int) []RunResult {
+	if workers <= 0 {
+		workers = 1
+	}
+	results := make([]RunResult, len(cfgs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = Train(ctx, cfgs[i])
+			}
+		}()
+	}
+	for i := range cfgs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// TrainSeeds runs cfg under seeds consecutive seeds starting at cfg.Seed (1 when unset), concurrently on
+// at most workers goroutines.
+func TrainSeeds(ctx context.Context, cfg Config, seeds, workers int) []RunResult {
+	base := cfg.Seed
+	if base == 0 {
+		base = 1
+	}
+	cfgs := make([]Config, seeds)
+	for i := range cfgs {
+		cfgs[i] = cfg
+		cfgs[i].Seed = base + int64(i)
+	}
+	return TrainAll(ctx, cfgs, workers)
+}
+
+// CurvePoint aggregates one episode index across runs.
+type CurvePoint struct {
+	Episode int
+	Runs    int
+	Reward  Stat
+	Steps   Stat
+	Success Stat
+}
+
+// LearningCurve aggregates per-episode reward, steps and success across runs. Runs that stopped early
+// simply drop out of later episodes.
+func LearningCurve(results []RunResult) []CurvePoint {
+	longest := 0
+	for _, result := range results {
+		if len(result.Episodes) > longest {
+			longest = len(result.Episodes)
+		}
+	}
+	curve := make([]CurvePoint, longest)
+	for i := range curve {
+		var rewards, steps, successes []float64
+		for _, result := range results {
+			if i >= len(result.Episodes) {
+				continue
+			}
+			ep := result.Episodes[i]
+			rewards = append(rewards, ep.Reward)
+			steps = append(steps, float64(ep.Steps))
+			success := 0.0
+			if ep.Success {
+				success = 1
+			}
+			successes = append(successes, success)
+		}
+		curve[i] = CurvePoint{
+			Episode: i + 1,
+			Runs:    len(rewards),
+			Reward:  Summarize(rewards),
+			Steps:   Summarize(steps),
+			Success: Summarize(successes),
+		}
+	}
+	return curve
+}
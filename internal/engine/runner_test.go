@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTrainAllMatchesSequentialRuns(t *testing.T) {
+	var cfgs []Config
+	for _, algorithm := range []string{AlgorithmQLearning, AlgorithmSARSA} {
+		for seed := int64(1); seed <= 3; seed++ {
+			cfgs = append(cfgs, Config{
+				Episodes:    25,
+				Seed:        seed,
+				Algorithm:   algorithm,
+				Rows:        4,
+				Cols:        4,
+				Epsilon:     0.3,
+				Alpha:       0.3,
+				Gamma:       0.9,
+				StepPenalty: 0.02,
+				Slips:       []SlipTile{{Row: 1, Col: 1, Probability: 0.4}},
+			})
+		}
+	}
+
+	parallel := TrainAll(context.Background(), cfgs, 4)
+	if len(parallel) != len(cfgs) {
+		t.Fatalf("expected %d results, got %d", len(cfgs), len(parallel))
+	}
+	for i, cfg := range cfgs {
+		sequential := Train(context.Background(), cfg)
+		if !reflect.DeepEqual(parallel[i].Episodes, sequential.Episodes) {
+			t.Fatalf("run %d (%s seed %d) differs when trained in the pool", i, cfg.Algorithm, cfg.Seed)
+		}
+		if len(sequential.Episodes) != cfg.Episodes {
+			t.Fatalf("expected %d episode records, got %d", cfg.Episodes, len(sequential.Episodes))
+		}
+	}
+
+	reward, success := RunResult{Episodes: []EpisodeRecord{{Reward: 1}, {Reward: 3, Success: true}, {Reward: 5, Success: true}}}.Window(2)
+	if reward != 4 || success != 1 {
+		t.Fatalf("expected the window to cover the last two episodes, got reward=%.2f success=%.2f", reward, success)
+	}
+}
+
+func TestLearningCurveAggregatesSeeds(t *testing.T) {
+	results := []RunResult{
+		{Episodes: []EpisodeRecord{{Reward: 1, Steps: 10}, {Reward: 2, Steps: 8, Success: true}}},
+		{Episodes: []EpisodeRecord{{Reward: 3, Steps: 6, Success: true}}},
+	}
+	curve := LearningCurve(results)
+	if len(curve) != 2 {
+		t.Fatalf("expected a point per episode of the longest run, got %d", len(curve))
+	}
+	first := curve[0]
+	if first.Runs != 2 || first.Reward.Mean != 2 || first.Steps.Mean != 8 || first.Success.Mean != 0.5 {
+		t.Fatalf("unexpected first point %+v", first)
+	}
+	if first.Reward.Low >= first.Reward.Mean || first.Reward.High <= first.Reward.Mean {
+		t.Fatalf("expected a non-degenerate interval around the mean, got %+v", first.Reward)
+	}
+	if second := curve[1]; second.Runs != 1 || second.Reward.Low != 2 || second.Reward.High != 2 {
+		t.Fatalf("expected a single run to give a zero-width interval, got %+v", second)
+	}
+
+	seeded := TrainSeeds(context.Background(), Config{Episodes: 5, Seed: 7, Rows: 4, Cols: 4}, 3, 2)
+	for i, result := range seeded {
+		if want := int64(7 + i); result.Config.Seed != want {
+			t.Fatalf("run %d: expected seed %d, got %d", i, want, result.Config.Seed)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Schedule kinds. Each moves a hyperparameter from its configured value towards Schedule.Final.
+const (
+	ScheduleConstant    = "constant"
+	ScheduleLinear      = "linear"
+	ScheduleExponential = "exponential"
+	ScheduleStep        = "step"
+	ScheduleCosine      = "cosine"
+	// ScheduleInverse divides the initial value by n, counted from 1: the episode number for epsilon and
+	// temperature (a GLIE schedule), and the visit count of the updated state-action pair for alpha.
+	ScheduleInverse = "inverse"
+)
+
+// Schedule describes how epsilon, alpha or the softmax temperature changes over training, starting from
+// the value in Config. Decreasing kinds never go below Final (increasing ones never above it). Linear and
+// cosine reach Final after Episodes episodes; exponential multiplies by Decay every episode and step every
+// Episodes episodes. Zero Decay selects 0.998 for exponential and 0.5 for step, so ten steps take a value
+// down about a thousandfold; zero Episodes selects the run length, or a tenth of it for step.
+type Schedule struct {
+	Kind     string  `json:"kind"`
+	Final    float64 `json:"final"`
+	Decay    float64 `json:"decay"`
+	Episodes int     `json:"episodes"`
+}
+
+// ParseSchedule reads the CLI form of a schedule: a kind optionally followed by comma-separated
+// key=value settings, such as "linear,final=0.05,episodes=500" or "exponential,decay=0.99".
+func ParseSchedule(spec string) (Schedule, error) {
+	parts := strings.Split(spec, ",")
+	schedule := Schedule{Kind: strings.TrimSpace(parts[0])}
+	if !validScheduleKind(schedule.Kind) || schedule.Kind == "" {
+		return Schedule{}, fmt.Errorf("unknown schedule %q (want constant, linear, exponential, step, cosine or inverse)", schedule.Kind)
+	}
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return Schedule{}, fmt.Errorf("schedule setting %q must be key=value", part)
+		}
+		var err error
+		switch key {
+		case "final":
+			schedule.Final, err = strconv.ParseFloat(value, 64)
+		case "decay":
+			schedule.Decay, err = strconv.ParseFloat(value, 64)
+		case "episodes":
+			schedule.Episodes, err = strconv.Atoi(value)
+		default:
+			return Schedule{}, fmt.Errorf("unknown schedule setting %q (want final, decay or episodes)", key)
+		}
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid schedule %s: %w", key, err)
+		}
+	}
+	return schedule, nil
+}
+
+func (s Schedule) String() string {
+	switch s.Kind {
+	case "", ScheduleConstant:
+		return ScheduleConstant
+	case ScheduleExponential:
+		return fmt.Sprintf("%s,final=%g,decay=%g", s.Kind, s.Final, s.Decay)
+	case ScheduleStep:
+		return fmt.Sprintf("%s,final=%g,decay=%g,episodes=%d", s.Kind, s.Final, s.Decay, s.Episodes)
+	case ScheduleInverse:
+		return fmt.Sprintf("%s,final=%g", s.Kind, s.Final)
+	default:
+		return fmt.Sprintf("%s,final=%g,episodes=%d", s.Kind, s.Final, s.Episodes)
+	}
+}
+
+func validScheduleKind(kind string) bool {
+	switch kind {
+	case "", ScheduleConstant, ScheduleLinear, ScheduleExponential, ScheduleStep, ScheduleCosine, ScheduleInverse:
+		return true
+	}
+	return false
+}
+
+// normalizeSchedule fills in defaults. An empty kind keeps the older multiplicative decay settings
+// (EpsilonDecay, SoftmaxDecay): exponential towards their floor when decay is set, constant otherwise.
+func normalizeSchedule(s Schedule, legacyDecay, legacyFloor float64, episodes int) Schedule {
+	if s.Kind == "" {
+		if legacyDecay > 0 {
+			return Schedule{Kind: ScheduleExponential, Final: legacyFloor, Decay: legacyDecay}
+		}
+		return Schedule{Kind: ScheduleConstant}
+	}
+	if !validScheduleKind(s.Kind) {
+		return Schedule{Kind: ScheduleConstant}
+	}
+	if s.Final < 0 {
+		s.Final = 0
+	}
+	if s.Decay <= 0 {
+		s.Decay = 0.998
+		if s.Kind == ScheduleStep {
+			s.Decay = 0.5
+		}
+	}
+	if s.Episodes <= 0 {
+		s.Episodes = max(1, episodes)
+		if s.Kind == ScheduleStep {
+			s.Episodes = max(1, episodes/10)
+		}
+	}
+	return s
+}
+
+// withHorizon fills in the Episodes that normalization chose for requested, pinning a default schedule
+// length to the run it was derived from.
+func withHorizon(requested, normalized Schedule) Schedule {
+	if requested.Kind != "" && requested.Episodes == 0 {
+		requested.Episodes = normalized.Episodes
+	}
+	return requested
+}
+
+// value is the scheduled value after n episodes (or, for alpha under ScheduleInverse, n earlier visits).
+func (s Schedule) value(initial float64, n int) float64 {
+	var value float64
+	switch s.Kind {
+	case ScheduleLinear:
+		progress := math.Min(float64(n)/float64(s.Episodes), 1)
+		value = initial + (s.Final-initial)*progress
+	case ScheduleExponential:
+		value = initial * math.Pow(s.Decay, float64(n))
+	case ScheduleStep:
+		value = initial * math.Pow(s.Decay, float64(n/s.Episodes))
+	case ScheduleCosine:
+		progress := math.Min(float64(n)/float64(s.Episodes), 1)
+		value = s.Final + (initial-s.Final)*(1+math.Cos(math.Pi*progress))/2
+	case ScheduleInverse:
+		value = initial / float64(n+1)
+	default:
+		return initial
+	}
+	if initial >= s.Final {
+		return math.Max(value, s.Final)
+	}
+	return math.Min(value, s.Final)
+}
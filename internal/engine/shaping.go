@@ -0,0 +1,68 @@
+package engine
+
+const (
+	// ShapingDistance adds Scale·(d(s)−d(s')) for every step toward the nearest goal. It is the original
+	// heuristic and the default, but it is not policy-invariant.
+	ShapingDistance = "distance"
+	// ShapingPotential adds γΦ(s')−Φ(s) with Φ = −Scale·d and Φ = 0 at terminal states, which leaves the
+	// optimal policy unchanged (Ng, Harada & Russell, 1999). Episodes cut off by MaxSteps keep Φ(s').
+	ShapingPotential = "potential"
+	// ShapingNone trains on the environment reward alone.
+	ShapingNone = "none"
+)
+
+// defaultShapingScale is the weight of one cell of goal distance in the shaping term.
+const defaultShapingScale = 0.1
+
+// RewardShaper computes the shaping term added to a training reward from the distance to the nearest goal
+// before and after a step. Environments without a distance report zero for both. terminal is set when
+// the step completed the task, not when the episode merely timed out.
+type RewardShaper interface {
+	Shape(prevDistance, nextDistance float64, terminal bool) float64
+}
+
+// NoShaping leaves rewards untouched.
+type NoShaping struct{}
+
+func (NoShaping) Shape(prevDistance, nextDistance float64, terminal bool) float64 {
+	return 0
+}
+
+// DistanceShaping rewards progress toward the goal by Scale per cell.
+type DistanceShaping struct {
+	Scale float64
+}
+
+func (s DistanceShaping) Shape(prevDistance, nextDistance float64, terminal bool) float64 {
+	return s.Scale * (prevDistance - nextDistance)
+}
+
+// PotentialShaping is potential-based shaping with Φ(s) = −Scale·d(s) and a zero potential for terminal
+// states. A truncated episode is not terminal: zeroing Φ there would add a bonus that does not telescope.
+type PotentialShaping struct {
+	Scale float64
+	Gamma float64
+}
+
+func (s PotentialShaping) Shape(prevDistance, nextDistance float64, terminal bool) float64 {
+	next := -s.Scale * nextDistance
+	if terminal {
+		next = 0
+	}
+	return s.Gamma*next + s.Scale*prevDistance
+}
+
+// newRewardShaper returns cfg.RewardShaper when set, otherwise the built-in shaper named by cfg.Shaping.
+func newRewardShaper(cfg Config) RewardShaper {
+	if cfg.RewardShaper != nil {
+		return cfg.RewardShaper
+	}
+	switch cfg.Shaping {
+	case ShapingNone:
+		return NoShaping{}
+	case ShapingPotential:
+		return PotentialShaping{Scale: cfg.ShapingScale, Gamma: cfg.Gamma}
+	default:
+		return DistanceShaping{Scale: cfg.ShapingScale}
+	}
+}
@@ -0,0 +1,275 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	SolverValueIteration  = "value-iteration"
+	SolverPolicyIteration = "policy-iteration"
+)
+
+// maxSolverGoals bounds the goal-collected bitmask so the exact state space stays tractable.
+const maxSolverGoals = 10
+
+const (
+	defaultSolverTolerance     = 1e-9
+	defaultSolverMaxIterations = 10000
+)
+
+// Solution holds the optimal values and greedy policy for the board's initial goal layout.
+type Solution struct {
+	Method     string
+	Values     [][]float64
+	QValues    [][][]float64
+	Policy     [][]int
+	Iterations int
+	Converged  bool
+}
+
+type outcome struct {
+	next     int
+	prob     float64
+	reward   float64
+	terminal bool
+}
+
+// solverModel is the exact transition model of a gridworld over (goal mask, row, col) states.
+// Timeouts are not modelled, so values describe the infinite-horizon discounted problem.
+type solverModel struct {
+	rows, cols  int
+	actions     int
+	masks       int
+	gamma       float64
+	transitions [][]outcome
+}
+
+// Solve builds the exact model of the gridworld described by cfg, after the same sanitization NewTrainer
+// applies, and runs the requested dynamic-programming method to convergence.
+func Solve(cfg Config, method string) (*Solution, error) {
+	if method == "" {
+		method = SolverValueIteration
+	}
+	if method != SolverValueIteration && method != SolverPolicyIteration {
+		return nil, fmt.Errorf("unsupported solver method %q", method)
+	}
+	cfg = normalizeConfig(cfg)
+	return solveEnv(newConfiguredGridworld(cfg, newTrainerRand(cfg.Seed)), cfg.Gamma, newRewardShaper(cfg), method)
+}
+
+func solveEnv(env *gridworldEnv, gamma float64, shaper RewardShaper, method string) (*Solution, error) {
+	model, err := newSolverModel(env, gamma, shaper)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		values     []float64
+		iterations int
+		converged  bool
+	)
+	if method == SolverPolicyIteration {
+		values, iterations, converged = model.policyIteration(defaultSolverTolerance, defaultSolverMaxIterations)
+	} else {
+		values, iterations, converged = model.valueIteration(defaultSolverTolerance, defaultSolverMaxIterations)
+	}
+	return model.solution(method, values, iterations, converged), nil
+}
+
+// newSolverModel folds the trainer's reward shaping into the rewards so Q* matches what the learners
+// estimate.
+func newSolverModel(env *gridworldEnv, gamma float64, shaper RewardShaper) (*solverModel, error) {
+	goals := env.initialGoals
+	if len(goals) > maxSolverGoals {
+		return nil, fmt.Errorf("solver supports at most %d goals (got %d)", maxSolverGoals, len(goals))
+	}
+	m := &solverModel{
+		rows:    env.rows,
+		cols:    env.cols,
+		actions: 4,
+		masks:   1 << len(goals),
+		gamma:   gamma,
+	}
+	total := m.masks * m.rows * m.cols * m.actions
+	transitions := make([][]outcome, total)
+	for mask := 0; mask < m.masks; mask++ {
+		for r := 0; r < m.rows; r++ {
+			for c := 0; c < m.cols; c++ {
+				for a := 0; a < m.actions; a++ {
+					transitions[m.index(mask, r, c)*m.actions+a] = m.outcomes(env, shaper, goals, mask, r, c, a)
+				}
+			}
+		}
+	}
+	m.transitions = transitions
+	return m, nil
+}
+
+func (m *solverModel) index(mask, row, col int) int {
+	return (mask*m.rows+row)*m.cols + col
+}
+
+// outcomes enumerates the slip-resolved moves of action from (row, col) while the goals in mask remain.
+func (m *solverModel) outcomes(env *gridworldEnv, shaper RewardShaper, goals []Goal, mask, row, col, action int) []outcome {
+	if mask == 0 {
+		return nil
+	}
+	probs := [4]float64{}
+	slip := env.tileAt(row, col)
+	if slip.kind == tileSlip && slip.slipProb > 0 {
+		for a := range probs {
+			probs[a] = slip.slipProb / 4
+		}
+		probs[action] += 1 - slip.slipProb
+	} else {
+		probs[action] = 1
+	}
+	result := make([]outcome, 0, 4)
+	for actual, prob := range probs {
+		if prob == 0 {
+			continue
+		}
+		nextRow, nextCol := moveOnGrid(env, row, col, actual)
+		reward := -env.stepPenalty
+		nextMask := mask
+		for i, goal := range goals {
+			if mask&(1<<i) != 0 && goal.Row == nextRow && goal.Col == nextCol {
+				reward += goal.Reward
+				nextMask &^= 1 << i
+				break
+			}
+		}
+		reward += shaper.Shape(maskPotential(env, goals, mask, row, col), maskPotential(env, goals, nextMask, nextRow, nextCol), nextMask == 0)
+		result = append(result, outcome{
+			next:     m.index(nextMask, nextRow, nextCol),
+			prob:     prob,
+			reward:   reward,
+			terminal: nextMask == 0,
+		})
+	}
+	return result
+}
+
+func moveOnGrid(env *gridworldEnv, row, col, action int) (int, int) {
+	nextRow, nextCol := env.positionAfter(row, col, action)
+	if env.tileAt(nextRow, nextCol).kind == tileWall {
+		return row, col
+	}
+	return nextRow, nextCol
+}
+
+// maskPotential mirrors gridworldEnv.potential for the goals still present in mask.
+func maskPotential(env *gridworldEnv, goals []Goal, mask, row, col int) float64 {
+	if mask == 0 {
+		return 0
+	}
+	minDist := env.rows + env.cols
+	for i, goal := range goals {
+		if mask&(1<<i) == 0 {
+			continue
+		}
+		d := absInt(goal.Row-row) + absInt(goal.Col-col)
+		if d < minDist {
+			minDist = d
+		}
+	}
+	return float64(minDist)
+}
+
+func (m *solverModel) actionValue(values []float64, state, action int) float64 {
+	q := 0.0
+	for _, o := range m.transitions[state*m.actions+action] {
+		next := 0.0
+		if !o.terminal {
+			next = values[o.next]
+		}
+		q += o.prob * (o.reward + m.gamma*next)
+	}
+	return q
+}
+
+func (m *solverModel) bestAction(values []float64, state int) (int, float64) {
+	best := 0
+	bestValue := m.actionValue(values, state, 0)
+	for a := 1; a < m.actions; a++ {
+		if q := m.actionValue(values, state, a); q > bestValue {
+			best = a
+			bestValue = q
+		}
+	}
+	return best, bestValue
+}
+
+func (m *solverModel) valueIteration(tolerance float64, maxIterations int) ([]float64, int, bool) {
+	values := make([]float64, m.masks*m.rows*m.cols)
+	for iteration := 1; iteration <= maxIterations; iteration++ {
+		delta := 0.0
+		for s := m.rows * m.cols; s < len(values); s++ {
+			_, best := m.bestAction(values, s)
+			delta = math.Max(delta, math.Abs(best-values[s]))
+			values[s] = best
+		}
+		if delta < tolerance {
+			return values, iteration, true
+		}
+	}
+	return values, maxIterations, false
+}
+
+func (m *solverModel) policyIteration(tolerance float64, maxIterations int) ([]float64, int, bool) {
+	values := make([]float64, m.masks*m.rows*m.cols)
+	policy := make([]int, len(values))
+	for iteration := 1; iteration <= maxIterations; iteration++ {
+		for sweep := 0; sweep < maxIterations; sweep++ {
+			delta := 0.0
+			for s := m.rows * m.cols; s < len(values); s++ {
+				v := m.actionValue(values, s, policy[s])
+				delta = math.Max(delta, math.Abs(v-values[s]))
+				values[s] = v
+			}
+			if delta < tolerance {
+				break
+			}
+		}
+		stable := true
+		for s := m.rows * m.cols; s < len(values); s++ {
+			best, bestValue := m.bestAction(values, s)
+			// Only switch on a strict improvement so ties cannot make the policy cycle.
+			if best != policy[s] && bestValue > m.actionValue(values, s, policy[s])+tolerance {
+				policy[s] = best
+				stable = false
+			}
+		}
+		if stable {
+			return values, iteration, true
+		}
+	}
+	return values, maxIterations, false
+}
+
+func (m *solverModel) solution(method string, values []float64, iterations int, converged bool) *Solution {
+	mask := m.masks - 1
+	sol := &Solution{
+		Method:     method,
+		Values:     make([][]float64, m.rows),
+		QValues:    make([][][]float64, m.rows),
+		Policy:     make([][]int, m.rows),
+		Iterations: iterations,
+		Converged:  converged,
+	}
+	for r := 0; r < m.rows; r++ {
+		sol.Values[r] = make([]float64, m.cols)
+		sol.QValues[r] = make([][]float64, m.cols)
+		sol.Policy[r] = make([]int, m.cols)
+		for c := 0; c < m.cols; c++ {
+			state := m.index(mask, r, c)
+			sol.Values[r][c] = values[state]
+			sol.QValues[r][c] = make([]float64, m.actions)
+			for a := 0; a < m.actions; a++ {
+				sol.QValues[r][c][a] = m.actionValue(values, state, a)
+			}
+			sol.Policy[r][c], _ = m.bestAction(values, state)
+		}
+	}
+	return sol
+}
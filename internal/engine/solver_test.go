@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSolverMethodsAgree(t *testing.T) {
+	cfg := Config{
+		Rows:        4,
+		Cols:        5,
+		Gamma:       0.9,
+		StepPenalty: 0.02,
+		Goals:       []Goal{{Row: 0, Col: 4, Reward: 1}, {Row: 3, Col: 4, Reward: 0.5}},
+		Walls:       []Position{{Row: 1, Col: 1}, {Row: 2, Col: 3}},
+		Slips:       []SlipTile{{Row: 1, Col: 2, Probability: 0.3}},
+	}
+
+	vi, err := Solve(cfg, SolverValueIteration)
+	if err != nil {
+		t.Fatalf("value iteration: %v", err)
+	}
+	pi, err := Solve(cfg, SolverPolicyIteration)
+	if err != nil {
+		t.Fatalf("policy iteration: %v", err)
+	}
+	if !vi.Converged || !pi.Converged {
+		t.Fatalf("expected both solvers to converge (vi=%t pi=%t)", vi.Converged, pi.Converged)
+	}
+	for r := range vi.Values {
+		for c := range vi.Values[r] {
+			if diff := math.Abs(vi.Values[r][c] - pi.Values[r][c]); diff > 1e-6 {
+				t.Fatalf("values disagree at (%d,%d): vi=%.6f pi=%.6f", r, c, vi.Values[r][c], pi.Values[r][c])
+			}
+		}
+	}
+	// Next to the top-right goal, stepping onto it is optimal.
+	if vi.Policy[0][3] != 1 {
+		t.Fatalf("expected optimal action right at (0,3), got %d", vi.Policy[0][3])
+	}
+}
+
+func TestSolverRejectsUnknownMethod(t *testing.T) {
+	if _, err := Solve(Config{}, "bogus"); err == nil {
+		t.Fatalf("expected error for unknown solver method")
+	}
+}
+
+func TestPotentialShapingShiftsOptimalQByThePotential(t *testing.T) {
+	cfg := Config{
+		Rows:        4,
+		Cols:        5,
+		Gamma:       0.9,
+		StepPenalty: 0.02,
+		Goals:       []Goal{{Row: 0, Col: 4, Reward: 1}},
+		Walls:       []Position{{Row: 1, Col: 1}, {Row: 2, Col: 3}},
+		Slips:       []SlipTile{{Row: 1, Col: 2, Probability: 0.3}},
+		Shaping:     ShapingNone,
+	}
+	plain, err := Solve(cfg, SolverValueIteration)
+	if err != nil {
+		t.Fatalf("solve unshaped: %v", err)
+	}
+	cfg.Shaping = ShapingPotential
+	cfg.ShapingScale = 0.5
+	shaped, err := Solve(cfg, SolverValueIteration)
+	if err != nil {
+		t.Fatalf("solve shaped: %v", err)
+	}
+	// Potential-based shaping changes Q*(s,a) by exactly -Φ(s), so the optimal policy is unchanged.
+	for r := range plain.QValues {
+		for c := range plain.QValues[r] {
+			phi := -cfg.ShapingScale * float64(absInt(r-0)+absInt(c-4))
+			for a, want := range plain.QValues[r][c] {
+				if got := shaped.QValues[r][c][a] + phi; math.Abs(got-want) > 1e-6 {
+					t.Fatalf("Q(%d,%d,%d): shaped+Φ=%.6f, unshaped=%.6f", r, c, a, got, want)
+				}
+			}
+			if plain.Policy[r][c] != shaped.Policy[r][c] {
+				t.Fatalf("policy changed at (%d,%d): %d vs %d", r, c, plain.Policy[r][c], shaped.Policy[r][c])
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package engine
+
+import "math"
+
+// tQuantile95 holds two-sided 95% Student t quantiles for 1..30 degrees of freedom. Seed counts are
+// usually small, where the normal 1.96 would understate the interval.
+var tQuantile95 = [...]float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// z95 is the two-sided 95% normal quantile used once t has effectively converged.
+const z95 = 1.96
+
+func criticalValue95(n int) float64 {
+	df := n - 1
+	if df >= 1 && df <= len(tQuantile95) {
+		return tQuantile95[df-1]
+	}
+	return z95
+}
+
+// MeanStd returns the sample mean and sample standard deviation (n-1 denominator). Fewer than two
+// samples have no spread.
+func MeanStd(samples []float64) (float64, float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	mean := 0.0
+	for _, v := range samples {
+		mean += v
+	}
+	mean /= float64(len(samples))
+	if len(samples) < 2 {
+		return mean, 0
+	}
+	variance := 0.0
+	for _, v := range samples {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(samples)-1))
+}
+
+// Stat summarizes samples of one quantity: the mean, its standard error and the 95% confidence bounds.
+type Stat struct {
+	Mean   float64
+	StdErr float64
+	Low    float64
+	High   float64
+}
+
+// Summarize computes a Stat with a Student t interval. A single sample has zero-width bounds.
+func Summarize(samples []float64) Stat {
+	mean, std := MeanStd(samples)
+	if len(samples) < 2 {
+		return Stat{Mean: mean, Low: mean, High: mean}
+	}
+	stdErr := std / math.Sqrt(float64(len(samples)))
+	half := criticalValue95(len(samples)) * stdErr
+	return Stat{Mean: mean, StdErr: stdErr, Low: mean - half, High: mean + half}
+}
+
+// meanCI95 returns the sample mean and the half-width of its 95% confidence interval.
+func meanCI95(samples []float64) (float64, float64) {
+	stat := Summarize(samples)
+	return stat.Mean, stat.High - stat.Mean
+}
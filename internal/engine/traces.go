@@ -0,0 +1,33 @@
+package engine
+
+type traceTable struct {
+	replacing bool
+	data      *qTable
+}
+
+func newTraceTable(states, actions int, replacing bool) *traceTable {
+	return &traceTable{replacing: replacing, data: newQTable(states, actions)}
+}
+
+func (e *traceTable) reset() {
+	clear(e.data.data)
+}
+
+func (e *traceTable) visit(state, action int) {
+	if e.replacing {
+		e.data.set(state, action, 1)
+		return
+	}
+	e.data.set(state, action, e.data.get(state, action)+1)
+}
+
+// apply moves every traced entry of q by step times its trace, then scales all traces by decay.
+func (e *traceTable) apply(q *qTable, step, decay float64) {
+	for i, trace := range e.data.data {
+		if trace == 0 {
+			continue
+		}
+		q.data[i] += step * trace
+		e.data.data[i] = trace * decay
+	}
+}
@@ -2,21 +2,11 @@ package engine
 
 import (
 	"context"
-	"fmt"
+	"math"
 	"math/rand"
 	"time"
 )
 
-func clampFloat(value, min, max float64) float64 {
-	if value < min {
-		return min
-	}
-	if value > max {
-		return max
-	}
-	return value
-}
-
 func maxFloat(a, b float64) float64 {
 	if a > b {
 		return a
@@ -48,60 +38,154 @@ func ScaledStepPenalty(rows, cols int, base float64) float64 {
 
 const (
 	StatusRunning         = "running"
+	StatusStep            = "step"
 	StatusEpisodeComplete = "episode_complete"
+	StatusEvaluation      = "evaluation"
 	StatusDone            = "done"
 	StatusCancelled       = "cancelled"
 )
 
 const (
-	AlgorithmMonteCarlo = "montecarlo"
-	AlgorithmQLearning  = "q-learning"
-	AlgorithmSARSA      = "sarsa"
+	AlgorithmMonteCarlo    = "montecarlo"
+	AlgorithmQLearning     = "q-learning"
+	AlgorithmDoubleQ       = "double-q"
+	AlgorithmDynaQ         = "dyna-q"
+	AlgorithmDynaQPlus     = "dyna-q-plus"
+	AlgorithmSARSA         = "sarsa"
+	AlgorithmExpectedSARSA = "expected-sarsa"
+	AlgorithmSARSALambda   = "sarsa-lambda"
+	AlgorithmQLambda       = "q-lambda"
+	// AlgorithmOffPolicyMonteCarlo learns the greedy policy from episodes of the exploring one by
+	// importance sampling.
+	AlgorithmOffPolicyMonteCarlo = "montecarlo-off-policy"
+	// AlgorithmNStepSARSA and AlgorithmTreeBackup bootstrap from Q after NSteps rewards. Tree Backup learns
+	// the greedy policy without importance sampling by backing up the expected value of untaken actions.
+	AlgorithmNStepSARSA = "n-step-sarsa"
+	AlgorithmTreeBackup = "tree-backup"
+)
+
+// Exploration strategies pick the behaviour policy over the Q-table. ε-greedy takes a uniformly random
+// action with probability Epsilon; softmax samples actions from a Boltzmann distribution over Q whose
+// temperature decays from SoftmaxTemperature towards SoftmaxMinTemperature; UCB tries every action once
+// and then maximizes Q(s,a) + UCBConstant·√(ln N(s) / n(s,a)) over the agent's visit counts.
+const (
+	ExplorationEpsilonGreedy = "epsilon-greedy"
+	ExplorationSoftmax       = "softmax"
+	ExplorationUCB           = "ucb"
 )
 
+// Importance sampling estimators for off-policy Monte Carlo. Weighted importance sampling normalizes the
+// returns by the sum of their weights, which is biased but has bounded variance; ordinary importance
+// sampling averages the weighted returns, which is unbiased but can have unbounded variance.
 const (
-	distanceRewardScale  = 0.1
-	distancePenaltyScale = 0.2
+	ImportanceWeighted = "weighted"
+	ImportanceOrdinary = "ordinary"
 )
 
+// Snapshot policies decide which steps send a full running snapshot. Episode-end, evaluation and final
+// snapshots are always sent.
+const (
+	SnapshotEverySteps = "steps"
+	SnapshotEpisodeEnd = "episode"
+	SnapshotTimed      = "timed"
+)
+
+// Config selects the environment, algorithm and hyperparameters of a run. Zero values select defaults,
+// though Validate insists on Epsilon, Alpha and Gamma, where a zero reads like a setting of its own.
+// The JSON keys are the lower camel case field names; they are what the web UI sends, what `tinyrl train
+// --config` reads and what `--run-json` summaries and checkpoints record, so renaming one is a breaking change.
 type Config struct {
-	Episodes              int
-	Seed                  int64
-	Epsilon               float64
-	EpsilonMin            float64
-	EpsilonDecay          float64
-	Alpha                 float64
-	Rows                  int
-	Cols                  int
-	StepDelayMs           int
-	MaxSteps              int
-	Gamma                 float64
-	Algorithm             string
-	Goals                 []Goal
-	StepPenalty           float64
-	RandomStart           bool
-	DumpTrajectory        bool
-	GoalCount             int
-	GoalInterval          int
-	SoftmaxTemperature    float64
-	SoftmaxMinTemperature float64
-	Lambda                float64
-	WarmupEpisodes        int
-	WarmupStepPenalty     float64
-	FeatureMapper         FeatureMapper
-	Walls                 []Position
-	Slips                 []SlipTile
+	Env                   string  `json:"env"`
+	Episodes              int     `json:"episodes"`
+	Seed                  int64   `json:"seed"`
+	Epsilon               float64 `json:"epsilon"`
+	EpsilonMin            float64 `json:"epsilonMin"`
+	EpsilonDecay          float64 `json:"epsilonDecay"`
+	Alpha                 float64 `json:"alpha"`
+	Rows                  int     `json:"rows"`
+	Cols                  int     `json:"cols"`
+	StepDelayMs           int     `json:"stepDelayMs"`
+	MaxSteps              int     `json:"maxSteps"`
+	Gamma                 float64 `json:"gamma"`
+	Algorithm             string  `json:"algorithm"`
+	Goals                 []Goal  `json:"goals"`
+	StepPenalty           float64 `json:"stepPenalty"`
+	RandomStart           bool    `json:"randomStart"`
+	DumpTrajectory        bool    `json:"dumpTrajectory"`
+	GoalCount             int     `json:"goalCount"`
+	GoalInterval          int     `json:"goalInterval"`
+	SoftmaxTemperature    float64 `json:"softmaxTemperature"`
+	SoftmaxMinTemperature float64 `json:"softmaxMinTemperature"`
+	// Exploration selects ExplorationEpsilonGreedy (the default), ExplorationSoftmax or ExplorationUCB.
+	// SoftmaxDecay multiplies the temperature after every episode (0 keeps it constant), like EpsilonDecay
+	// does for ε, and UCBConstant defaults to 1.
+	Exploration  string  `json:"exploration"`
+	SoftmaxDecay float64 `json:"softmaxDecay"`
+	UCBConstant  float64 `json:"ucbConstant"`
+	// CountBonus adds the MBIE-EB bonus CountBonus/√n(s,a) to every learning target, n(s,a) being how
+	// often the action was taken in that state (0 disables). Q-values then start at CountBonus/(1−γ), the
+	// most the bonus alone can be worth, so untried actions look at least as good as tried ones. The bonus
+	// fades with visits, composes with any exploration strategy and never shows up in reported rewards.
+	CountBonus        float64       `json:"countBonus"`
+	Lambda            float64       `json:"lambda"`
+	ReplacingTraces   bool          `json:"replacingTraces"`
+	PlanningSteps     int           `json:"planningSteps"`
+	DynaKappa         float64       `json:"dynaKappa"`
+	WallSwitchEpisode int           `json:"wallSwitchEpisode"`
+	SwitchedWalls     []Position    `json:"switchedWalls"`
+	TrackValueError   bool          `json:"trackValueError"`
+	GoalAwareState    bool          `json:"goalAwareState"`
+	WarmupEpisodes    int           `json:"warmupEpisodes"`
+	WarmupStepPenalty float64       `json:"warmupStepPenalty"`
+	FeatureMapper     FeatureMapper `json:"-"`
+	Walls             []Position    `json:"walls"`
+	Slips             []SlipTile    `json:"slips"`
+	// EvalEvery runs EvalEpisodes greedy evaluation episodes after every EvalEvery training episodes
+	// (0 disables). Evaluation never updates the Q-table, visit counters or the training RNG, and custom
+	// environments are only evaluated this way if they implement CloneableEnvironment.
+	EvalEvery    int `json:"evalEvery"`
+	EvalEpisodes int `json:"evalEpisodes"`
+	// SnapshotPolicy selects SnapshotEverySteps (the default, one running snapshot every SnapshotEvery
+	// steps), SnapshotEpisodeEnd (no running snapshots) or SnapshotTimed (at most one running snapshot per
+	// SnapshotIntervalMs). Full snapshots copy the value map, so throttling them is what keeps long runs fast.
+	SnapshotPolicy     string `json:"snapshotPolicy"`
+	SnapshotEvery      int    `json:"snapshotEvery"`
+	SnapshotIntervalMs int    `json:"snapshotIntervalMs"`
+	// StepEvents sends a StatusStep snapshot for every step the policy skips. Step events carry only the
+	// counters and agent positions: no value map, layout or config.
+	StepEvents bool `json:"stepEvents"`
+	// Shaping picks the shaping term added to training rewards: ShapingDistance (the default),
+	// ShapingPotential or ShapingNone, weighted by ShapingScale (default 0.1 per cell of goal distance).
+	// RewardShaper, when set, replaces the built-in shapers. Evaluation always reports unshaped returns.
+	// On the coop board each agent is shaped towards its own goal and episode rewards stay unshaped.
+	Shaping      string       `json:"shaping"`
+	ShapingScale float64      `json:"shapingScale"`
+	RewardShaper RewardShaper `json:"-"`
+	// EpsilonSchedule, AlphaSchedule and TemperatureSchedule move Epsilon, Alpha and SoftmaxTemperature
+	// over training. Left empty, epsilon and the temperature keep the EpsilonDecay/EpsilonMin and
+	// SoftmaxDecay/SoftmaxMinTemperature behaviour and alpha stays constant.
+	EpsilonSchedule     Schedule `json:"epsilonSchedule"`
+	AlphaSchedule       Schedule `json:"alphaSchedule"`
+	TemperatureSchedule Schedule `json:"temperatureSchedule"`
+	// EveryVisit makes on-policy Monte Carlo learn from every occurrence of a state-action pair in an
+	// episode instead of only the first. ImportanceSampling picks ImportanceWeighted (the default) or
+	// ImportanceOrdinary for off-policy Monte Carlo, which is every-visit and averages returns instead of
+	// stepping by Alpha.
+	EveryVisit         bool   `json:"everyVisit"`
+	ImportanceSampling string `json:"importanceSampling"`
+	// NSteps is how many rewards n-step SARSA and Tree Backup sum before bootstrapping (default 4).
+	NSteps int `json:"nSteps"`
 }
 
 type Position struct {
-	Row int
-	Col int
+	Row int `json:"row"`
+	Col int `json:"col"`
 }
 
 type SlipTile struct {
-	Row         int
-	Col         int
-	Probability float64
+	Row         int     `json:"row"`
+	Col         int     `json:"col"`
+	Probability float64 `json:"probability"`
 }
 
 type Snapshot struct {
@@ -121,44 +205,149 @@ type Snapshot struct {
 	TotalSteps        int
 	Config            Config
 	Status            string
+	ValueError        *ValueError
+	Evaluation        *Evaluation
+	Agents            []Position
+	Switches          []Position
+	Door              *Position
+	DoorOpen          bool
+	// Epsilon and Alpha are the current scheduled values; under an inverse alpha schedule Alpha is the
+	// step size of the latest update. Temperature is the current Boltzmann temperature under softmax
+	// exploration and 0 otherwise.
+	Epsilon     float64
+	Alpha       float64
+	Temperature float64
+	// Visits counts how often each cell was visited during the episode; set on episode_complete snapshots.
+	Visits [][]int
+	// Shaping is the shaping part of Reward and EpisodeShaping the shaping part of EpisodeReward, so the
+	// environment's own reward is Reward-Shaping.
+	Shaping        float64
+	EpisodeShaping float64
 }
 
 type Trainer struct {
 	cfg               Config
+	requested         Config
 	baseStepPenalty   float64
 	rng               *rand.Rand
-	env               *gridworldEnv
+	source            *countingSource
+	env               Environment
+	grid              *gridworldEnv
 	agent             *epsilonGreedyAgent
 	values            *valueTable
 	qvalues           *qTable
+	traces            *traceTable
+	doubleQ           [2]*qTable
+	model             *dynaModel
+	optimal           *Solution
+	coop              *coopEnv
+	coopAgents        [coopAgents]*epsilonGreedyAgent
+	coopQ             [coopAgents]*qTable
 	step              int
 	successCount      int
 	episodesCompleted int
 	totalReward       float64
 	totalSteps        int
+	logger            Logger
+	logLevel          LogLevel
+	lastSnapshotAt    time.Time
+	// Per-episode scratch buffers, reused so the step loop does not allocate.
+	episodeVisits []int
+	mcStates      []int
+	mcActions     []int
+	mcRewards     []float64
+	mcSeen        []bool
+	mcFirst       []bool
+	shaper        RewardShaper
+	// Starting values the schedules count from, and the step size of the latest update.
+	startEpsilon     float64
+	startAlpha       float64
+	startTemperature float64
+	alpha            float64
+	// Shaping terms of the current episode, reported next to the rewards that include them.
+	stepShaping    float64
+	episodeShaping float64
+	// mcProbabilities holds the behaviour policy's probability of each action in the episode.
+	mcProbabilities []float64
+	// mcWeights sums the importance sampling weights (weighted) or counts the returns (ordinary) that
+	// off-policy Monte Carlo has averaged into each Q-value.
+	mcWeights *qTable
+	// nstep buffers the transitions n-step SARSA and Tree Backup have not backed up yet.
+	nstep *nStepBuffer
 }
 
 type Goal struct {
-	Row    int
-	Col    int
-	Reward float64
+	Row    int     `json:"row"`
+	Col    int     `json:"col"`
+	Reward float64 `json:"reward"`
 }
 
+// NewTrainer builds a trainer for the environment named by cfg.Env, defaulting to the gridworld.
 func NewTrainer(cfg Config) *Trainer {
+	requested := cfg
+	cfg = normalizeConfig(cfg)
+	source := newCountingSource(cfg.Seed)
+	rng := rand.New(source)
+	var trainer *Trainer
+	if cfg.Env == EnvCoop {
+		trainer = newCoopTrainer(cfg, rng)
+	} else {
+		trainer = newTrainer(cfg, rng, newEnvironment(cfg, rng))
+	}
+	trainer.requested = requested
+	trainer.source = source
+	trainer.startSchedules()
+	return trainer
+}
+
+// NewTrainerWithEnvironment trains on a caller-supplied environment. Goal layouts, walls, slips, random starts
+// and value-error tracking only apply to the built-in gridworld.
+func NewTrainerWithEnvironment(cfg Config, env Environment) *Trainer {
+	requested := cfg
+	cfg = normalizeConfig(cfg)
+	source := newCountingSource(cfg.Seed)
+	trainer := newTrainer(cfg, rand.New(source), env)
+	trainer.requested = requested
+	trainer.source = source
+	trainer.startSchedules()
+	return trainer
+}
+
+func normalizeConfig(cfg Config) Config {
+	if cfg.Env == "" {
+		cfg.Env = EnvGridworld
+	}
+	switch cfg.Env {
+	case EnvGridworld, EnvCoop:
+		// allowed
+	default:
+		cfg.Env = EnvGridworld
+	}
+	if cfg.Env == EnvCoop {
+		// The cooperative board always trains two independent Q-learners.
+		cfg.Algorithm = AlgorithmQLearning
+	}
 	if cfg.Algorithm == "" {
 		cfg.Algorithm = AlgorithmMonteCarlo
 	}
 	switch cfg.Algorithm {
-	case AlgorithmMonteCarlo, AlgorithmQLearning, AlgorithmSARSA:
+	case AlgorithmMonteCarlo, AlgorithmOffPolicyMonteCarlo, AlgorithmQLearning, AlgorithmDoubleQ, AlgorithmDynaQ, AlgorithmDynaQPlus, AlgorithmSARSA, AlgorithmExpectedSARSA, AlgorithmSARSALambda, AlgorithmQLambda, AlgorithmNStepSARSA, AlgorithmTreeBackup:
 		// allowed
 	default:
 		cfg.Algorithm = AlgorithmMonteCarlo
 	}
+	switch cfg.ImportanceSampling {
+	case ImportanceWeighted, ImportanceOrdinary:
+		// allowed
+	default:
+		cfg.ImportanceSampling = ImportanceWeighted
+	}
+	defaultRows, defaultCols := DefaultBoardSize(cfg.Env)
 	if cfg.Rows <= 0 {
-		cfg.Rows = 4
+		cfg.Rows = defaultRows
 	}
 	if cfg.Cols <= 0 {
-		cfg.Cols = 4
+		cfg.Cols = defaultCols
 	}
 	if cfg.StepDelayMs < 0 {
 		cfg.StepDelayMs = 0
@@ -178,6 +367,9 @@ func NewTrainer(cfg Config) *Trainer {
 	if cfg.EpsilonMin < 0 || cfg.EpsilonMin > cfg.Epsilon {
 		cfg.EpsilonMin = 0
 	}
+	if cfg.Alpha <= 0 || cfg.Alpha > 1 {
+		cfg.Alpha = 0.1
+	}
 	if cfg.EpsilonDecay < 0 {
 		cfg.EpsilonDecay = 0
 	}
@@ -196,20 +388,72 @@ func NewTrainer(cfg Config) *Trainer {
 	if cfg.SoftmaxMinTemperature > cfg.SoftmaxTemperature {
 		cfg.SoftmaxMinTemperature = cfg.SoftmaxTemperature
 	}
+	switch cfg.Exploration {
+	case ExplorationEpsilonGreedy, ExplorationSoftmax, ExplorationUCB:
+		// allowed
+	default:
+		cfg.Exploration = ExplorationEpsilonGreedy
+	}
+	if cfg.SoftmaxDecay < 0 {
+		cfg.SoftmaxDecay = 0
+	}
+	if cfg.UCBConstant <= 0 {
+		cfg.UCBConstant = 1
+	}
+	if cfg.CountBonus < 0 {
+		cfg.CountBonus = 0
+	}
+	cfg.EpsilonSchedule = normalizeSchedule(cfg.EpsilonSchedule, cfg.EpsilonDecay, cfg.EpsilonMin, cfg.Episodes)
+	cfg.AlphaSchedule = normalizeSchedule(cfg.AlphaSchedule, 0, 0, cfg.Episodes)
+	cfg.TemperatureSchedule = normalizeSchedule(cfg.TemperatureSchedule, cfg.SoftmaxDecay, cfg.SoftmaxMinTemperature, cfg.Episodes)
 	if cfg.Lambda < 0 || cfg.Lambda > 1 {
 		cfg.Lambda = 0.9
 	}
+	if cfg.NSteps <= 0 {
+		cfg.NSteps = 4
+	}
+	if cfg.PlanningSteps < 0 {
+		cfg.PlanningSteps = 0
+	}
+	if cfg.DynaKappa < 0 {
+		cfg.DynaKappa = 0
+	}
+	if cfg.WallSwitchEpisode < 0 {
+		cfg.WallSwitchEpisode = 0
+	}
 	if cfg.WarmupEpisodes < 0 {
 		cfg.WarmupEpisodes = 0
 	}
 	if cfg.WarmupStepPenalty < 0 {
 		cfg.WarmupStepPenalty = 0
 	}
-	seed := cfg.Seed
-	if seed == 0 {
-		seed = 1
+	if cfg.EvalEvery < 0 {
+		cfg.EvalEvery = 0
+	}
+	if cfg.EvalEpisodes <= 0 {
+		cfg.EvalEpisodes = 10
+	}
+	switch cfg.Shaping {
+	case ShapingDistance, ShapingPotential, ShapingNone:
+		// allowed
+	default:
+		cfg.Shaping = ShapingDistance
+	}
+	if cfg.ShapingScale <= 0 {
+		cfg.ShapingScale = defaultShapingScale
+	}
+	switch cfg.SnapshotPolicy {
+	case SnapshotEverySteps, SnapshotEpisodeEnd, SnapshotTimed:
+		// allowed
+	default:
+		cfg.SnapshotPolicy = SnapshotEverySteps
+	}
+	if cfg.SnapshotEvery <= 0 {
+		cfg.SnapshotEvery = 1
+	}
+	if cfg.SnapshotIntervalMs <= 0 {
+		cfg.SnapshotIntervalMs = 100
 	}
-	rng := rand.New(rand.NewSource(seed))
 	sanitizedGoals := sanitizeGoals(cfg.Goals, cfg.Rows, cfg.Cols)
 	if cfg.GoalCount > 0 {
 		sanitizedGoals = autoPlaceGoals(cfg.Rows, cfg.Cols, cfg.GoalCount)
@@ -220,7 +464,14 @@ func NewTrainer(cfg Config) *Trainer {
 	cfg.Goals = cloneGoals(sanitizedGoals)
 	effectivePenalty := ScaledStepPenalty(cfg.Rows, cfg.Cols, cfg.StepPenalty)
 	cfg.StepPenalty = effectivePenalty
-	env := newGridworldEnv(cfg.Rows, cfg.Cols, sanitizedGoals, effectivePenalty, cfg.MaxSteps)
+	return cfg
+}
+
+func newTrainerRand(seed int64) *rand.Rand {
+	return rand.New(newCountingSource(seed))
+}
+
+func newTrainer(cfg Config, rng *rand.Rand, env Environment) *Trainer {
 	var (
 		values  *valueTable
 		qvalues *qTable
@@ -231,24 +482,65 @@ func NewTrainer(cfg Config) *Trainer {
 		mapper = DistanceBands3Mapper{}
 	}
 
-	qvalues = newQTable(env.rows, env.cols, 4)
-	env.setRandomSource(rng)
-	for _, wall := range cfg.Walls {
-		env.setWall(wall.Row, wall.Col)
-	}
-	for _, slip := range cfg.Slips {
-		env.setSlipTile(slip.Row, slip.Col, slip.Probability)
+	states, actions := env.NumStates(), env.NumActions()
+	qvalues = newQTable(states, actions)
+	qvalues.fill(optimisticValue(cfg))
+	var traces *traceTable
+	if usesTraces(cfg.Algorithm) {
+		traces = newTraceTable(states, actions, cfg.ReplacingTraces)
+	}
+	var model *dynaModel
+	if cfg.Algorithm == AlgorithmDynaQ || cfg.Algorithm == AlgorithmDynaQPlus {
+		model = newDynaModel(actions)
+	}
+	var doubleQ [2]*qTable
+	if cfg.Algorithm == AlgorithmDoubleQ {
+		doubleQ = [2]*qTable{newQTable(states, actions), newQTable(states, actions)}
+		doubleQ[0].fill(optimisticValue(cfg))
+		doubleQ[1].fill(optimisticValue(cfg))
+	}
+	var mcWeights *qTable
+	if cfg.Algorithm == AlgorithmOffPolicyMonteCarlo {
+		mcWeights = newQTable(states, actions)
+	}
+	var nstep *nStepBuffer
+	if usesNSteps(cfg.Algorithm) {
+		nstep = newNStepBuffer(cfg.NSteps)
 	}
 	agent := newEpsilonGreedyAgent(rng, values, qvalues, cfg.Epsilon)
-	return &Trainer{
+	agent.explore(cfg)
+	agent.recordProbability = mcWeights != nil
+	grid, _ := env.(*gridworldEnv)
+	trainer := &Trainer{
 		cfg:             cfg,
-		baseStepPenalty: effectivePenalty,
+		baseStepPenalty: cfg.StepPenalty,
 		rng:             rng,
 		env:             env,
+		grid:            grid,
 		agent:           agent,
 		values:          values,
 		qvalues:         qvalues,
-	}
+		traces:          traces,
+		doubleQ:         doubleQ,
+		mcWeights:       mcWeights,
+		nstep:           nstep,
+		model:           model,
+		shaper:          newRewardShaper(cfg),
+	}
+	trainer.refreshOptimal()
+	return trainer
+}
+
+func usesTraces(algorithm string) bool {
+	return algorithm == AlgorithmSARSALambda || algorithm == AlgorithmQLambda
+}
+
+func usesNSteps(algorithm string) bool {
+	return algorithm == AlgorithmNStepSARSA || algorithm == AlgorithmTreeBackup
+}
+
+func isMonteCarlo(algorithm string) bool {
+	return algorithm == AlgorithmMonteCarlo || algorithm == AlgorithmOffPolicyMonteCarlo
 }
 
 func sanitizeGoals(goals []Goal, rows, cols int) []Goal {
@@ -305,55 +597,141 @@ func (t *Trainer) Run(ctx context.Context) <-chan Snapshot {
 		if t.cfg.Episodes <= 0 {
 			return
 		}
-		for episode := 1; episode <= t.cfg.Episodes; episode++ {
+		// Restored trainers continue numbering after the episodes already in the checkpoint.
+		first := t.episodesCompleted + 1
+		last := t.episodesCompleted + t.cfg.Episodes
+		t.applySchedules(t.episodesCompleted)
+		evalEvery := t.cfg.EvalEvery
+		if evalEvery > 0 && !t.canEvaluateDuringTraining() {
+			t.logf(LogWarn, "skipping periodic evaluation: the custom environment does not implement CloneableEnvironment")
+			evalEvery = 0
+		}
+		for episode := first; episode <= last; episode++ {
 			select {
 			case <-ctx.Done():
 				out <- t.snapshot(StatusCancelled, episode, 0, 0, 0)
 				return
 			default:
 			}
-			if t.cfg.EpsilonDecay > 0 {
-				currentEps := clampFloat(t.cfg.Epsilon, 0, 1)
-				t.agent.setEpsilon(currentEps)
+			if t.coop != nil {
+				t.runCoopEpisode(ctx, episode, out)
+			} else {
+				t.runEpisode(ctx, episode, out)
 			}
-			t.runEpisode(ctx, episode, out)
-			if t.cfg.EpsilonDecay > 0 {
-				t.cfg.Epsilon = maxFloat(t.cfg.EpsilonMin, t.cfg.Epsilon*t.cfg.EpsilonDecay)
+			t.applySchedules(episode)
+			if evalEvery > 0 && episode%evalEvery == 0 {
+				snapshot := t.snapshot(StatusEvaluation, episode, 0, 0, 0)
+				snapshot.Evaluation = t.Evaluate(t.cfg.EvalEpisodes, t.cfg.Seed)
+				t.logf(LogDebug, "evaluation after episode %d: mean_return=%.3f success_rate=%.3f",
+					episode, snapshot.Evaluation.MeanReturn, snapshot.Evaluation.SuccessRate)
+				out <- snapshot
 			}
 		}
-		out <- t.snapshot(StatusDone, t.cfg.Episodes, 0, 0, 0)
+		out <- t.snapshot(StatusDone, last, 0, 0, 0)
 	}()
 	return out
 }
 
+func (t *Trainer) startSchedules() {
+	t.startEpsilon = t.cfg.Epsilon
+	t.startAlpha = t.cfg.Alpha
+	t.startTemperature = t.cfg.SoftmaxTemperature
+	t.alpha = t.cfg.Alpha
+}
+
+// applySchedules moves epsilon, alpha and the temperature to their values after n episodes. An inverse
+// alpha schedule depends on visit counts instead, so Alpha keeps its starting value for stepSize.
+func (t *Trainer) applySchedules(n int) {
+	t.cfg.Epsilon = t.cfg.EpsilonSchedule.value(t.startEpsilon, n)
+	t.setEpsilon(t.cfg.Epsilon)
+	if t.cfg.AlphaSchedule.Kind != ScheduleInverse {
+		t.cfg.Alpha = t.cfg.AlphaSchedule.value(t.startAlpha, n)
+		t.alpha = t.cfg.Alpha
+	}
+	t.cfg.SoftmaxTemperature = t.cfg.TemperatureSchedule.value(t.startTemperature, n)
+	t.setTemperature(t.cfg.SoftmaxTemperature)
+}
+
+// stepSize is the learning rate for an update of (state, action), whose visits are counted in visits.
+// Dyna-Q+ also plans with actions that were never taken; an inverse schedule treats those as first visits.
+func (t *Trainer) stepSize(visits *visitTable, state, action int) float64 {
+	if t.cfg.AlphaSchedule.Kind == ScheduleInverse {
+		t.alpha = t.cfg.AlphaSchedule.value(t.cfg.Alpha, max(visits.get(state, action), 1)-1)
+	}
+	return t.alpha
+}
+
+func (t *Trainer) setEpsilon(value float64) {
+	t.agent.setEpsilon(value)
+	for _, agent := range t.coopAgents {
+		if agent != nil {
+			agent.setEpsilon(value)
+		}
+	}
+}
+
+func (t *Trainer) setTemperature(value float64) {
+	t.agent.setTemperature(value)
+	for _, agent := range t.coopAgents {
+		if agent != nil {
+			agent.setTemperature(value)
+		}
+	}
+}
+
+// temperature is the Boltzmann temperature snapshots report, 0 when the agents explore ε-greedily.
+func (t *Trainer) temperature() float64 {
+	if t.cfg.Exploration != ExplorationSoftmax {
+		return 0
+	}
+	return t.cfg.SoftmaxTemperature
+}
+
 func (t *Trainer) runEpisode(ctx context.Context, episode int, out chan<- Snapshot) {
-	if t.cfg.Algorithm == AlgorithmMonteCarlo {
+	if isMonteCarlo(t.cfg.Algorithm) {
 		t.applyWarmupPenalty(episode)
-		t.agent.resetVisits()
+		// Count-based exploration needs the counts of every episode so far.
+		if !t.countsVisits() {
+			t.agent.resetVisits()
+		}
 	}
-	if t.cfg.GoalCount > 0 && t.cfg.GoalInterval > 0 {
+	if t.grid != nil && t.cfg.GoalCount > 0 && t.cfg.GoalInterval > 0 {
 		shouldShuffle := episode == 1 || (episode-1)%t.cfg.GoalInterval == 0
 		if shouldShuffle {
-			newGoals := autoPlaceGoals(t.env.rows, t.env.cols, t.cfg.GoalCount)
-			t.env.setGoals(newGoals)
+			newGoals := autoPlaceGoals(t.grid.rows, t.grid.cols, t.cfg.GoalCount)
+			t.grid.setGoals(newGoals)
 			t.cfg.Goals = cloneGoals(newGoals)
+			t.refreshOptimal()
+			t.logf(LogInfo, "episode %d: placed %d new goals", episode, len(newGoals))
 		}
 	}
-	t.env.reset()
+	if t.grid != nil && t.cfg.WallSwitchEpisode > 0 && episode == t.cfg.WallSwitchEpisode {
+		t.switchWalls()
+		t.logf(LogInfo, "episode %d: walls switched to %d cells", episode, len(t.cfg.SwitchedWalls))
+	}
+	if t.traces != nil {
+		t.traces.reset()
+	}
+	t.env.Reset()
 	if t.cfg.RandomStart {
 		t.applyRandomStart()
 	}
-	state := position{row: t.env.currRow, col: t.env.currCol}
+	t.stepShaping, t.episodeShaping = 0, 0
+	state := t.env.State()
 	action := t.agent.act(t.env)
-	var mcStates []position
-	var mcActions []int
-	var mcRewards []float64
-	if t.cfg.Algorithm == AlgorithmMonteCarlo {
+	mcStates := t.mcStates[:0]
+	mcActions := t.mcActions[:0]
+	mcRewards := t.mcRewards[:0]
+	mcProbabilities := t.mcProbabilities[:0]
+	if isMonteCarlo(t.cfg.Algorithm) {
 		mcStates = append(mcStates, state)
 		mcActions = append(mcActions, action)
-		mcRewards = make([]float64, 0, t.env.maxSteps)
+		mcProbabilities = append(mcProbabilities, t.agent.probability)
 	}
-	visits := make(map[position]int, t.env.rows*t.env.cols)
+	if t.nstep != nil {
+		t.nstep.store(0, state, action)
+	}
+	visits := t.resetEpisodeVisits(t.env.NumStates())
 	visits[state]++
 	steps := 0
 	episodeReward := 0.0
@@ -366,16 +744,17 @@ func (t *Trainer) runEpisode(ctx context.Context, episode int, out chan<- Snapsh
 			return
 		default:
 		}
-		prevDistance := t.env.potential(state.row, state.col)
-		baseReward, done := t.env.step(action)
-		nextState := position{row: t.env.currRow, col: t.env.currCol}
-		newDistance := t.env.potential(nextState.row, nextState.col)
-		reward := baseReward
-		delta := prevDistance - newDistance
-		reward += 0.1 * delta
-		if done && len(t.env.goals) == 0 {
+		prevDistance := t.potential()
+		baseReward, done := t.env.Step(action)
+		nextState := t.env.State()
+		if done && t.env.GoalReached() {
 			goalReached = true
 		}
+		t.stepShaping = t.shaper.Shape(prevDistance, t.potential(), goalReached)
+		t.episodeShaping += t.stepShaping
+		reward := baseReward + t.stepShaping
+		// The count bonus only steers learning; episode rewards report what the environment paid.
+		learnReward := reward + t.countBonus(t.agent, state, action)
 		t.agent.update(reward)
 		episodeReward += reward
 		steps++
@@ -384,22 +763,46 @@ func (t *Trainer) runEpisode(ctx context.Context, episode int, out chan<- Snapsh
 		var nextAction int
 		switch t.cfg.Algorithm {
 		case AlgorithmQLearning:
-			t.updateQLearning(state, action, reward, nextState, done)
+			t.updateQLearning(state, action, learnReward, nextState, done)
+		case AlgorithmExpectedSARSA:
+			t.updateExpectedSARSA(state, action, learnReward, nextState, done)
+		case AlgorithmDoubleQ:
+			t.updateDoubleQ(state, action, learnReward, nextState, done)
+		case AlgorithmDynaQ, AlgorithmDynaQPlus:
+			t.updateQLearning(state, action, learnReward, nextState, done)
+			t.model.record(state, action, reward, nextState, done, t.step, t.cfg.Algorithm == AlgorithmDynaQPlus)
+			t.plan()
 		case AlgorithmSARSA:
 			if !done {
 				nextAction = t.agent.act(t.env)
 			}
-			t.updateSARSA(state, action, reward, nextState, nextAction, done)
-		case AlgorithmMonteCarlo:
-			mcRewards = append(mcRewards, reward)
+			t.updateSARSA(state, action, learnReward, nextState, nextAction, done)
+		case AlgorithmSARSALambda, AlgorithmQLambda:
+			if !done {
+				nextAction = t.agent.act(t.env)
+			}
+			t.updateTraces(state, action, learnReward, nextState, nextAction, done)
+		case AlgorithmNStepSARSA, AlgorithmTreeBackup:
+			if !done {
+				nextAction = t.agent.act(t.env)
+			}
+			t.nstep.storeReward(steps, learnReward)
+			t.nstep.store(steps, nextState, nextAction)
+			// The pair from n steps back now has all n rewards, or the episode ended first.
+			if tau := steps - t.cfg.NSteps; tau >= 0 {
+				t.updateNStep(tau, steps, !done)
+			}
+		case AlgorithmMonteCarlo, AlgorithmOffPolicyMonteCarlo:
+			mcRewards = append(mcRewards, learnReward)
 			if !done {
 				nextAction = t.agent.act(t.env)
 				mcStates = append(mcStates, nextState)
 				mcActions = append(mcActions, nextAction)
+				mcProbabilities = append(mcProbabilities, t.agent.probability)
 			}
 		}
 		visits[nextState]++
-		out <- t.snapshot(StatusRunning, episode, steps, episodeReward, reward)
+		t.emitStep(out, episode, steps, episodeReward, reward)
 		if t.cfg.StepDelayMs > 0 {
 			select {
 			case <-ctx.Done():
@@ -413,11 +816,11 @@ func (t *Trainer) runEpisode(ctx context.Context, episode int, out chan<- Snapsh
 		}
 		state = nextState
 		switch t.cfg.Algorithm {
-		case AlgorithmQLearning:
+		case AlgorithmQLearning, AlgorithmDoubleQ, AlgorithmDynaQ, AlgorithmDynaQPlus, AlgorithmExpectedSARSA:
 			action = t.agent.act(t.env)
-		case AlgorithmSARSA:
+		case AlgorithmSARSA, AlgorithmSARSALambda, AlgorithmQLambda, AlgorithmNStepSARSA, AlgorithmTreeBackup:
 			action = nextAction
-		case AlgorithmMonteCarlo:
+		case AlgorithmMonteCarlo, AlgorithmOffPolicyMonteCarlo:
 			action = nextAction
 		default:
 			action = t.agent.act(t.env)
@@ -426,17 +829,28 @@ func (t *Trainer) runEpisode(ctx context.Context, episode int, out chan<- Snapsh
 	if goalReached {
 		t.successCount++
 	}
-	if t.cfg.Algorithm == AlgorithmMonteCarlo {
+	if t.nstep != nil {
+		// Back up the pairs of the last n-1 steps from the rewards up to the end of the episode.
+		for tau := max(0, steps-t.cfg.NSteps+1); tau < steps; tau++ {
+			t.updateNStep(tau, steps, false)
+		}
+	}
+	switch t.cfg.Algorithm {
+	case AlgorithmMonteCarlo:
 		t.updateMonteCarloQ(mcStates, mcActions, mcRewards)
+	case AlgorithmOffPolicyMonteCarlo:
+		t.updateOffPolicyMonteCarloQ(mcStates, mcActions, mcRewards, mcProbabilities)
 	}
+	t.mcStates, t.mcActions, t.mcRewards, t.mcProbabilities = mcStates, mcActions, mcRewards, mcProbabilities
 	t.totalReward += episodeReward
 	t.totalSteps += steps
 	t.episodesCompleted++
-	t.printVisitHeatmap(episode, visits)
-	out <- t.snapshot(StatusEpisodeComplete, episode, steps, episodeReward, lastReward)
+	out <- t.episodeComplete(episode, steps, episodeReward, lastReward, goalReached, visits)
 }
 
-func (t *Trainer) updateMonteCarloQ(states []position, actions []int, rewards []float64) {
+// updateMonteCarloQ moves each state-action pair towards the return that followed its first occurrence in
+// the episode, or every occurrence with EveryVisit.
+func (t *Trainer) updateMonteCarloQ(states []int, actions []int, rewards []float64) {
 	if t.qvalues == nil {
 		return
 	}
@@ -449,30 +863,70 @@ func (t *Trainer) updateMonteCarloQ(states []position, actions []int, rewards []
 	if len(rewards) != len(actions) {
 		return
 	}
-	type visitKey struct {
-		row    int
-		col    int
-		action int
+	if len(t.mcSeen) != len(t.qvalues.data) {
+		t.mcSeen = make([]bool, len(t.qvalues.data))
+	}
+	seen := t.mcSeen
+	first := t.mcFirst[:0]
+	for i, state := range states {
+		key := state*t.qvalues.actions + actions[i]
+		first = append(first, !seen[key])
+		seen[key] = true
 	}
-	seen := make(map[visitKey]bool, len(actions))
+	clear(seen)
+	t.mcFirst = first
 	G := 0.0
 	for i := len(rewards) - 1; i >= 0; i-- {
 		G = rewards[i] + t.cfg.Gamma*G
+		if !first[i] && !t.cfg.EveryVisit {
+			continue
+		}
 		state := states[i]
 		action := actions[i]
-		key := visitKey{row: state.row, col: state.col, action: action}
-		if seen[key] {
-			continue
+		current := t.qvalues.get(state, action)
+		updated := current + t.stepSize(t.agent.qVisits, state, action)*(G-current)
+		t.qvalues.set(state, action, updated)
+	}
+}
+
+// updateOffPolicyMonteCarloQ is every-visit off-policy Monte Carlo control (Sutton & Barto §5.7): the
+// target policy is greedy in Q, splitting ties evenly, while the agent's exploration is the behaviour
+// policy that chose the actions with the recorded probabilities. Walking back from the end of the episode,
+// W is the importance sampling ratio π/b of the actions after step i. Weighted importance sampling stops
+// once W is 0; ordinary importance sampling keeps averaging those zero-weighted returns.
+func (t *Trainer) updateOffPolicyMonteCarloQ(states, actions []int, rewards, probabilities []float64) {
+	ordinary := t.cfg.ImportanceSampling == ImportanceOrdinary
+	G, W := 0.0, 1.0
+	for i := len(rewards) - 1; i >= 0; i-- {
+		if W == 0 && !ordinary {
+			return
 		}
-		seen[key] = true
-		current := t.qvalues.get(state.row, state.col, action)
-		updated := current + t.cfg.Alpha*(G-current)
-		t.qvalues.set(state.row, state.col, action, updated)
+		G = rewards[i] + t.cfg.Gamma*G
+		state, action := states[i], actions[i]
+		current := t.qvalues.get(state, action)
+		if ordinary {
+			returns := t.mcWeights.get(state, action) + 1
+			t.mcWeights.set(state, action, returns)
+			t.qvalues.set(state, action, current+(W*G-current)/returns)
+		} else {
+			weights := t.mcWeights.get(state, action) + W
+			t.mcWeights.set(state, action, weights)
+			t.qvalues.set(state, action, current+W/weights*(G-current))
+		}
+		W *= t.qvalues.greedyProbability(state, action) / probabilities[i]
 	}
 }
 
+func (t *Trainer) switchWalls() {
+	t.grid.clearWalls()
+	for _, wall := range t.cfg.SwitchedWalls {
+		t.grid.setWall(wall.Row, wall.Col)
+	}
+	t.refreshOptimal()
+}
+
 func (t *Trainer) applyWarmupPenalty(episode int) {
-	if t.env == nil {
+	if t.grid == nil {
 		return
 	}
 	penalty := t.baseStepPenalty
@@ -484,72 +938,298 @@ func (t *Trainer) applyWarmupPenalty(episode int) {
 	if penalty < 0 {
 		penalty = 0
 	}
-	t.env.setStepPenalty(penalty)
+	t.grid.setStepPenalty(penalty)
 }
 
 func (t *Trainer) applyRandomStart() {
-	if t.env == nil || t.rng == nil {
+	if t.grid == nil || t.rng == nil {
 		return
 	}
-	if t.env.rows <= 0 || t.env.cols <= 0 {
+	if t.grid.rows <= 0 || t.grid.cols <= 0 {
 		return
 	}
-	t.env.currRow = t.rng.Intn(t.env.rows)
-	t.env.currCol = t.rng.Intn(t.env.cols)
+	t.grid.currRow = t.rng.Intn(t.grid.rows)
+	t.grid.currCol = t.rng.Intn(t.grid.cols)
+}
+
+// potential is the distance-to-goal used for reward shaping, or zero when the environment has none.
+func (t *Trainer) potential() float64 {
+	if shaped, ok := t.env.(potentialEnvironment); ok {
+		return shaped.Potential()
+	}
+	return 0
+}
+
+// countsVisits reports whether exploration or the step size reads the agents' visit counts beyond
+// breaking ties.
+func (t *Trainer) countsVisits() bool {
+	return t.cfg.Exploration == ExplorationUCB || t.cfg.CountBonus > 0 || t.cfg.AlphaSchedule.Kind == ScheduleInverse
 }
 
-func (t *Trainer) updateQLearning(state position, action int, reward float64, next position, done bool) {
+// optimisticValue is the initial Q-value: zero, or the discounted sum of first-visit count bonuses. That
+// sum diverges for γ = 1, so its horizon is capped at 100 steps.
+func optimisticValue(cfg Config) float64 {
+	if cfg.CountBonus <= 0 {
+		return 0
+	}
+	horizon := 100.0
+	if cfg.Gamma < 1 {
+		horizon = math.Min(horizon, 1/(1-cfg.Gamma))
+	}
+	return cfg.CountBonus * horizon
+}
+
+// countBonus is the MBIE-EB bonus β/√n(s,a) for agent having taken action in state, whose visit it
+// already counted. It fades as the pair is tried again, so the learned values still settle on Q*.
+func (t *Trainer) countBonus(agent *epsilonGreedyAgent, state, action int) float64 {
+	if t.cfg.CountBonus <= 0 {
+		return 0
+	}
+	visits := agent.qVisits.get(state, action)
+	if visits < 1 {
+		visits = 1
+	}
+	return t.cfg.CountBonus / math.Sqrt(float64(visits))
+}
+
+func (t *Trainer) updateQLearning(state int, action int, reward float64, next int, done bool) {
 	if t.qvalues == nil {
 		return
 	}
-	current := t.qvalues.get(state.row, state.col, action)
+	current := t.qvalues.get(state, action)
 	var nextValue float64
 	if !done {
-		nextValue = t.qvalues.maxValue(next.row, next.col)
+		nextValue = t.qvalues.maxValue(next)
 	}
 	target := reward + t.cfg.Gamma*nextValue
-	updated := current + t.cfg.Alpha*(target-current)
-	t.qvalues.set(state.row, state.col, action, updated)
+	updated := current + t.stepSize(t.agent.qVisits, state, action)*(target-current)
+	t.qvalues.set(state, action, updated)
 }
 
-func (t *Trainer) updateSARSA(state position, action int, reward float64, next position, nextAction int, done bool) {
+func (t *Trainer) updateSARSA(state int, action int, reward float64, next int, nextAction int, done bool) {
 	if t.qvalues == nil {
 		return
 	}
-	current := t.qvalues.get(state.row, state.col, action)
+	current := t.qvalues.get(state, action)
 	var nextValue float64
 	if !done {
-		nextValue = t.qvalues.get(next.row, next.col, nextAction)
+		nextValue = t.qvalues.get(next, nextAction)
 	}
 	target := reward + t.cfg.Gamma*nextValue
-	updated := current + t.cfg.Alpha*(target-current)
-	t.qvalues.set(state.row, state.col, action, updated)
+	updated := current + t.stepSize(t.agent.qVisits, state, action)*(target-current)
+	t.qvalues.set(state, action, updated)
 }
 
-func (t *Trainer) printVisitHeatmap(episode int, visits map[position]int) {
-	if visits == nil {
+// plan replays PlanningSteps transitions sampled from the learned model through updateQLearning.
+// Dyna-Q+ adds an exploration bonus that grows with the time since the transition was last tried.
+func (t *Trainer) plan() {
+	if t.model == nil {
 		return
 	}
-	fmt.Printf("visit heatmap (episode %d)\n", episode)
-	for r := 0; r < t.env.rows; r++ {
-		for c := 0; c < t.env.cols; c++ {
-			count := visits[position{row: r, col: c}]
-			if count == 0 {
-				fmt.Printf("  . ")
-			} else {
-				fmt.Printf("%3d ", count)
+	for i := 0; i < t.cfg.PlanningSteps; i++ {
+		key, transition, ok := t.model.sample(t.rng)
+		if !ok {
+			return
+		}
+		reward := transition.reward
+		if t.cfg.Algorithm == AlgorithmDynaQPlus {
+			reward += explorationBonus(t.cfg.DynaKappa, t.step, transition.lastStep)
+		}
+		t.updateQLearning(key.state, key.action, reward, transition.next, transition.done)
+	}
+}
+
+// updateDoubleQ updates one of the two estimators, chosen by a fair coin, using the other estimator to
+// evaluate its own greedy action. The shared qvalues table holds their average, which drives action
+// selection and the reported value map.
+func (t *Trainer) updateDoubleQ(state int, action int, reward float64, next int, done bool) {
+	if t.qvalues == nil || t.doubleQ[0] == nil || t.doubleQ[1] == nil {
+		return
+	}
+	learner, evaluator := t.doubleQ[0], t.doubleQ[1]
+	if t.rng.Intn(2) == 1 {
+		learner, evaluator = evaluator, learner
+	}
+	current := learner.get(state, action)
+	var nextValue float64
+	if !done {
+		nextValue = evaluator.get(next, learner.argmax(next))
+	}
+	target := reward + t.cfg.Gamma*nextValue
+	learner.set(state, action, current+t.stepSize(t.agent.qVisits, state, action)*(target-current))
+	average := (t.doubleQ[0].get(state, action) + t.doubleQ[1].get(state, action)) / 2
+	t.qvalues.set(state, action, average)
+}
+
+func (t *Trainer) updateExpectedSARSA(state int, action int, reward float64, next int, done bool) {
+	if t.qvalues == nil {
+		return
+	}
+	current := t.qvalues.get(state, action)
+	var nextValue float64
+	if !done {
+		nextValue = t.agent.expectedQValue(next)
+	}
+	target := reward + t.cfg.Gamma*nextValue
+	updated := current + t.stepSize(t.agent.qVisits, state, action)*(target-current)
+	t.qvalues.set(state, action, updated)
+}
+
+// updateTraces performs a SARSA(λ) or Watkins Q(λ) backup. Watkins' variant bootstraps from the greedy
+// value and cuts every trace as soon as the behaviour policy takes an exploratory action.
+func (t *Trainer) updateTraces(state int, action int, reward float64, next int, nextAction int, done bool) {
+	if t.qvalues == nil || t.traces == nil {
+		return
+	}
+	current := t.qvalues.get(state, action)
+	var nextValue float64
+	decay := t.cfg.Gamma * t.cfg.Lambda
+	if !done {
+		if t.cfg.Algorithm == AlgorithmQLambda {
+			nextValue = t.qvalues.maxValue(next)
+			if !t.qvalues.isGreedy(next, nextAction) {
+				decay = 0
 			}
+		} else {
+			nextValue = t.qvalues.get(next, nextAction)
 		}
-		fmt.Println()
 	}
+	tdError := reward + t.cfg.Gamma*nextValue - current
+	t.traces.visit(state, action)
+	// Every traced pair shares the step size of the pair just visited.
+	t.traces.apply(t.qvalues, t.stepSize(t.agent.qVisits, state, action)*tdError, decay)
+}
+
+// updateNStep backs up the pair taken at step tau from the rewards up to step horizon, bootstrapping from
+// the pair at horizon unless the episode ended there. n-step SARSA sums the discounted rewards; Tree
+// Backup (Sutton & Barto §7.5) instead mixes each intermediate step's sampled return with the greedy value
+// of the state, weighted by how likely the greedy target policy was to take the action actually taken.
+func (t *Trainer) updateNStep(tau, horizon int, bootstrap bool) {
+	buffer := t.nstep
+	treeBackup := t.cfg.Algorithm == AlgorithmTreeBackup
+	G := 0.0
+	if bootstrap {
+		last := buffer.state(horizon)
+		if treeBackup {
+			G = t.qvalues.maxValue(last)
+		} else {
+			G = t.qvalues.get(last, buffer.action(horizon))
+		}
+	}
+	for k := horizon; k > tau; k-- {
+		if treeBackup && k < horizon {
+			state := buffer.state(k)
+			follow := t.qvalues.greedyProbability(state, buffer.action(k))
+			G = (1-follow)*t.qvalues.maxValue(state) + follow*G
+		}
+		G = buffer.reward(k) + t.cfg.Gamma*G
+	}
+	state, action := buffer.state(tau), buffer.action(tau)
+	current := t.qvalues.get(state, action)
+	t.qvalues.set(state, action, current+t.stepSize(t.agent.qVisits, state, action)*(G-current))
+}
+
+// emitStep sends whatever the snapshot policy asks for after a training step.
+func (t *Trainer) emitStep(out chan<- Snapshot, episode, steps int, episodeReward, reward float64) {
+	if t.wantsFullSnapshot() {
+		out <- t.snapshot(StatusRunning, episode, steps, episodeReward, reward)
+		return
+	}
+	if t.cfg.StepEvents {
+		out <- t.stepEvent(episode, steps, episodeReward, reward)
+	}
+}
+
+func (t *Trainer) wantsFullSnapshot() bool {
+	switch t.cfg.SnapshotPolicy {
+	case SnapshotEpisodeEnd:
+		return false
+	case SnapshotTimed:
+		now := time.Now()
+		if now.Sub(t.lastSnapshotAt) < time.Duration(t.cfg.SnapshotIntervalMs)*time.Millisecond {
+			return false
+		}
+		t.lastSnapshotAt = now
+		return true
+	default:
+		return t.cfg.SnapshotEvery <= 1 || t.step%t.cfg.SnapshotEvery == 0
+	}
+}
+
+// stepEvent is the lightweight per-step update: counters and positions without copying any tables.
+func (t *Trainer) stepEvent(episode, steps int, episodeReward, reward float64) Snapshot {
+	event := Snapshot{
+		Step:              t.step,
+		Episode:           episode,
+		EpisodeSteps:      steps,
+		EpisodeReward:     episodeReward,
+		Reward:            reward,
+		SuccessCount:      t.successCount,
+		EpisodesCompleted: t.episodesCompleted,
+		TotalReward:       t.totalReward,
+		TotalSteps:        t.totalSteps,
+		Status:            StatusStep,
+		Epsilon:           t.cfg.Epsilon,
+		Alpha:             t.alpha,
+		Temperature:       t.temperature(),
+	}
+	if t.coop != nil {
+		event.Position = Position{Row: t.coop.positions[0].row, Col: t.coop.positions[0].col}
+		event.Agents = make([]Position, len(t.coop.positions))
+		for i, pos := range t.coop.positions {
+			event.Agents[i] = Position{Row: pos.row, Col: pos.col}
+		}
+		return event
+	}
+	event.Position = t.env.StatePosition(t.env.State())
+	return event
+}
+
+// resetEpisodeVisits returns the zeroed per-state visit counter for a new episode.
+func (t *Trainer) resetEpisodeVisits(states int) []int {
+	if len(t.episodeVisits) != states {
+		t.episodeVisits = make([]int, states)
+	}
+	clear(t.episodeVisits)
+	return t.episodeVisits
+}
+
+// visitGrid projects one episode's state visits onto the board's cells.
+func (t *Trainer) visitGrid(visits []int) [][]int {
+	info := t.renderInfo()
+	projector := t.projector()
+	grid := make([][]int, info.Rows)
+	for r := range grid {
+		grid[r] = make([]int, info.Cols)
+	}
+	for state, count := range visits {
+		if count == 0 {
+			continue
+		}
+		pos := projector.StatePosition(state)
+		if pos.Row >= 0 && pos.Row < info.Rows && pos.Col >= 0 && pos.Col < info.Cols {
+			grid[pos.Row][pos.Col] += count
+		}
+	}
+	return grid
+}
+
+// episodeComplete builds the end-of-episode snapshot, attaching the episode's visit counts.
+func (t *Trainer) episodeComplete(episode, steps int, episodeReward, lastReward float64, success bool, visits []int) Snapshot {
+	snapshot := t.snapshot(StatusEpisodeComplete, episode, steps, episodeReward, lastReward)
+	snapshot.Visits = t.visitGrid(visits)
+	t.stepShaping, t.episodeShaping = 0, 0
+	t.logf(LogDebug, "episode %d: reward=%.3f steps=%d success=%t", episode, episodeReward, steps, success)
+	return snapshot
 }
 
 func (t *Trainer) snapshot(status string, episode, episodeSteps int, episodeReward, reward float64) Snapshot {
+	info := t.renderInfo()
 	var valueMap [][]float64
 	if t.values != nil {
 		valueMap = t.values.cloneData()
 	} else if t.qvalues != nil {
-		valueMap = t.qvalues.stateValues()
+		valueMap = t.qvalues.stateValues(t.projector(), info.Rows, info.Cols)
 	}
 	return Snapshot{
 		Step:              t.step,
@@ -557,18 +1237,42 @@ func (t *Trainer) snapshot(status string, episode, episodeSteps int, episodeRewa
 		EpisodeSteps:      episodeSteps,
 		EpisodeReward:     episodeReward,
 		Reward:            reward,
-		Position:          Position{Row: t.env.currRow, Col: t.env.currCol},
+		Position:          info.Position,
 		ValueMap:          valueMap,
-		Goals:             cloneGoals(t.env.goals),
-		Walls:             clonePositions(t.env.wallPositions()),
-		Slips:             cloneSlips(t.env.slipTiles()),
+		Goals:             info.Goals,
+		Walls:             info.Walls,
+		Slips:             info.Slips,
 		SuccessCount:      t.successCount,
 		EpisodesCompleted: t.episodesCompleted,
 		TotalReward:       t.totalReward,
 		TotalSteps:        t.totalSteps,
 		Config:            t.cfg,
 		Status:            status,
+		ValueError:        t.valueError(),
+		Agents:            info.Agents,
+		Switches:          info.Switches,
+		Door:              info.Door,
+		DoorOpen:          info.DoorOpen,
+		Shaping:           t.stepShaping,
+		EpisodeShaping:    t.episodeShaping,
+		Epsilon:           t.cfg.Epsilon,
+		Alpha:             t.alpha,
+		Temperature:       t.temperature(),
+	}
+}
+
+func (t *Trainer) renderInfo() RenderInfo {
+	if t.coop != nil {
+		return t.coop.render()
+	}
+	return t.env.Render()
+}
+
+func (t *Trainer) projector() stateProjector {
+	if t.coop != nil {
+		return t.coop
 	}
+	return t.env
 }
 
 func cloneGoals(goals []Goal) []Goal {
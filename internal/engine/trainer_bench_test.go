@@ -6,6 +6,7 @@ import (
 )
 
 func benchmarkEpisodes(b *testing.B, cfg Config) {
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		trainer := NewTrainer(cfg)
 		ctx := context.Background()
@@ -14,6 +15,21 @@ func benchmarkEpisodes(b *testing.B, cfg Config) {
 	}
 }
 
+// benchmarkSteps trains a single b.N-step episode on a board whose goal is walled off, so ns/op and
+// allocs/op measure the step loop itself with trainer setup and the end-of-episode snapshot amortized.
+func benchmarkSteps(b *testing.B, cfg Config) {
+	cfg.Episodes = 1
+	cfg.MaxSteps = b.N
+	cfg.Goals = []Goal{{Row: 0, Col: cfg.Cols - 1, Reward: 1}}
+	cfg.Walls = []Position{{Row: 0, Col: cfg.Cols - 2}, {Row: 1, Col: cfg.Cols - 1}}
+	cfg.SnapshotPolicy = SnapshotEpisodeEnd
+	trainer := NewTrainer(cfg)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range trainer.Run(context.Background()) {
+	}
+}
+
 func BenchmarkEpisodeMonteCarlo(b *testing.B) {
 	cfg := Config{
 		Episodes:     1,
@@ -49,3 +65,43 @@ func BenchmarkEpisodeQLearning(b *testing.B) {
 	}
 	benchmarkEpisodes(b, cfg)
 }
+
+// BenchmarkStepQLearning runs the Q-learning step loop alone; it should report 0 allocs/op.
+func BenchmarkStepQLearning(b *testing.B) {
+	cfg := Config{
+		Seed:         99,
+		Algorithm:    AlgorithmQLearning,
+		Rows:         6,
+		Cols:         6,
+		StepPenalty:  0.02,
+		Epsilon:      0.2,
+		EpsilonMin:   0.05,
+		EpsilonDecay: 0.999,
+		Alpha:        0.2,
+		Gamma:        0.9,
+	}
+	benchmarkSteps(b, cfg)
+}
+
+func BenchmarkLargeBoardEveryStepSnapshots(b *testing.B) {
+	benchmarkEpisodes(b, largeBoardConfig(SnapshotEverySteps))
+}
+
+func BenchmarkLargeBoardEpisodeSnapshots(b *testing.B) {
+	benchmarkEpisodes(b, largeBoardConfig(SnapshotEpisodeEnd))
+}
+
+func largeBoardConfig(policy string) Config {
+	return Config{
+		Episodes:       20,
+		Seed:           99,
+		Algorithm:      AlgorithmQLearning,
+		Rows:           20,
+		Cols:           20,
+		StepPenalty:    0.02,
+		Epsilon:        0.2,
+		Alpha:          0.2,
+		Gamma:          0.9,
+		SnapshotPolicy: policy,
+	}
+}
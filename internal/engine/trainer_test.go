@@ -2,6 +2,12 @@ package engine
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -130,3 +136,1202 @@ func sameGoals(a, b []Goal) bool {
 	}
 	return true
 }
+
+func TestEligibilityTracesSmoke(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmSARSALambda, AlgorithmQLambda} {
+		cfg := Config{
+			Episodes:     50,
+			Seed:         7,
+			Algorithm:    algorithm,
+			Rows:         4,
+			Cols:         4,
+			GoalCount:    1,
+			GoalInterval: 0,
+			StepPenalty:  0.02,
+			Epsilon:      0.5,
+			EpsilonMin:   0.05,
+			EpsilonDecay: 0.998,
+			Alpha:        0.2,
+			Gamma:        0.9,
+			Lambda:       0.8,
+		}
+
+		trainer := NewTrainer(cfg)
+		ctx := context.Background()
+
+		var final Snapshot
+		for snapshot := range trainer.Run(ctx) {
+			final = snapshot
+		}
+
+		if final.Config.Algorithm != algorithm {
+			t.Fatalf("expected algorithm %s, got %s", algorithm, final.Config.Algorithm)
+		}
+		if final.EpisodesCompleted != cfg.Episodes {
+			t.Fatalf("%s: expected %d episodes completed, got %d", algorithm, cfg.Episodes, final.EpisodesCompleted)
+		}
+		if final.SuccessCount < 1 {
+			t.Fatalf("%s: expected at least one successful episode, got %d", algorithm, final.SuccessCount)
+		}
+	}
+}
+
+func TestEligibilityTracesCreditEarlierPairs(t *testing.T) {
+	// A three-step episode 0 -> 1 -> 2 -> goal taking action 1 throughout, rewarded only at the end.
+	run := func(lambda float64) *Trainer {
+		trainer := NewTrainer(Config{Algorithm: AlgorithmSARSALambda, Alpha: 0.5, Gamma: 0.9, Lambda: lambda})
+		trainer.updateTraces(0, 1, 0, 1, 1, false)
+		trainer.updateTraces(1, 1, 0, 2, 1, false)
+		trainer.updateTraces(2, 1, 1, 3, 0, true)
+		return trainer
+	}
+	traced := run(0.8)
+	decay := 0.9 * 0.8
+	for state, want := range []float64{0.5 * decay * decay, 0.5 * decay, 0.5} {
+		if got := traced.qvalues.get(state, 1); math.Abs(got-want) > 1e-12 {
+			t.Fatalf("λ=0.8: expected Q(%d,1)=%.4f, got %.4f", state, want, got)
+		}
+	}
+	oneStep := run(0)
+	if oneStep.qvalues.get(0, 1) != 0 || oneStep.qvalues.get(1, 1) != 0 || oneStep.qvalues.get(2, 1) != 0.5 {
+		t.Fatalf("λ=0: expected only the last pair to learn, got %.4f %.4f %.4f",
+			oneStep.qvalues.get(0, 1), oneStep.qvalues.get(1, 1), oneStep.qvalues.get(2, 1))
+	}
+}
+
+func TestReplacingTracesAreCappedAtOne(t *testing.T) {
+	for _, replacing := range []bool{false, true} {
+		traces := newTraceTable(1, 4, replacing)
+		traces.visit(0, 2)
+		traces.visit(0, 2)
+		traces.visit(0, 2)
+		want := 3.0
+		if replacing {
+			want = 1
+		}
+		if got := traces.data.get(0, 2); got != want {
+			t.Fatalf("replacing=%t: expected trace %.0f after three visits, got %.2f", replacing, want, got)
+		}
+	}
+}
+
+func TestWatkinsQLambdaCutsTracesAfterExploring(t *testing.T) {
+	for _, c := range []struct {
+		algorithm  string
+		nextAction int
+		cleared    bool
+	}{
+		{AlgorithmQLambda, 2, true},
+		{AlgorithmQLambda, 0, false},
+		{AlgorithmSARSALambda, 2, false},
+	} {
+		trainer := NewTrainer(Config{Algorithm: c.algorithm, Alpha: 0.5, Gamma: 0.9, Lambda: 0.8})
+		// Action 0 is greedy in state 1, so following it with action 2 is exploratory.
+		trainer.qvalues.set(1, 0, 1)
+		trainer.updateTraces(0, 1, 0, 1, c.nextAction, false)
+		trace := trainer.traces.data.get(0, 1)
+		if (trace == 0) != c.cleared {
+			t.Fatalf("%s next action %d: expected cleared=%t, got trace %.3f", c.algorithm, c.nextAction, c.cleared, trace)
+		}
+	}
+}
+
+func TestExpectedSARSAParitySmoke(t *testing.T) {
+	cfg := Config{
+		Episodes:     50,
+		Seed:         7,
+		Algorithm:    AlgorithmExpectedSARSA,
+		Rows:         4,
+		Cols:         4,
+		GoalCount:    1,
+		GoalInterval: 0,
+		StepPenalty:  0.02,
+		Epsilon:      0.5,
+		EpsilonMin:   0.05,
+		EpsilonDecay: 0.998,
+		Alpha:        0.2,
+		Gamma:        0.9,
+	}
+
+	trainer := NewTrainer(cfg)
+	ctx := context.Background()
+
+	var final Snapshot
+	for snapshot := range trainer.Run(ctx) {
+		final = snapshot
+	}
+
+	if final.Config.Algorithm != AlgorithmExpectedSARSA {
+		t.Fatalf("expected algorithm %s, got %s", AlgorithmExpectedSARSA, final.Config.Algorithm)
+	}
+	if final.EpisodesCompleted != cfg.Episodes {
+		t.Fatalf("expected %d episodes completed, got %d", cfg.Episodes, final.EpisodesCompleted)
+	}
+	if final.SuccessCount < 1 {
+		t.Fatalf("expected at least one successful episode, got %d", final.SuccessCount)
+	}
+}
+
+func TestExpectedSARSATargetAveragesThePolicy(t *testing.T) {
+	// Q(1,·) = [4 0 2 0] with ε=0.2: the expectation is 0.05·6 + 0.8·4 = 3.5, so the target from
+	// reward 1 with γ=0.5 is 2.75, between SARSA's 2 (after action 2) and Q-learning's 3.
+	targets := map[string]float64{}
+	for _, algorithm := range []string{AlgorithmExpectedSARSA, AlgorithmSARSA, AlgorithmQLearning} {
+		trainer := NewTrainer(Config{Algorithm: algorithm, Epsilon: 0.2, Alpha: 1, Gamma: 0.5})
+		trainer.qvalues.set(1, 0, 4)
+		trainer.qvalues.set(1, 2, 2)
+		switch algorithm {
+		case AlgorithmExpectedSARSA:
+			trainer.updateExpectedSARSA(0, 3, 1, 1, false)
+		case AlgorithmSARSA:
+			trainer.updateSARSA(0, 3, 1, 1, 2, false)
+		case AlgorithmQLearning:
+			trainer.updateQLearning(0, 3, 1, 1, false)
+		}
+		targets[algorithm] = trainer.qvalues.get(0, 3)
+	}
+	if got := targets[AlgorithmExpectedSARSA]; math.Abs(got-2.75) > 1e-12 {
+		t.Fatalf("expected the Expected SARSA target r + γΣπQ = 2.75, got %.4f", got)
+	}
+	if targets[AlgorithmSARSA] != 2 || targets[AlgorithmQLearning] != 3 {
+		t.Fatalf("expected SARSA and Q-learning targets 2 and 3, got %.4f and %.4f", targets[AlgorithmSARSA], targets[AlgorithmQLearning])
+	}
+}
+
+func TestDoubleQLearningReducesOverestimation(t *testing.T) {
+	var slips []SlipTile
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 4; c++ {
+			slips = append(slips, SlipTile{Row: r, Col: c, Probability: 1})
+		}
+	}
+	base := Config{
+		Episodes:    300,
+		Rows:        4,
+		Cols:        4,
+		StepPenalty: 0.02,
+		Epsilon:     0.3,
+		Alpha:       0.2,
+		Gamma:       0.9,
+		Slips:       slips,
+	}
+
+	// Every tile randomizes the move, so all actions share the random-walk value.
+	truth := meanRandomWalkValue(base, 500)
+
+	meanValue := func(algorithm string) float64 {
+		total := 0.0
+		seeds := []int64{1, 2, 3}
+		for _, seed := range seeds {
+			cfg := base
+			cfg.Seed = seed
+			cfg.Algorithm = algorithm
+			trainer := NewTrainer(cfg)
+			var final Snapshot
+			for snapshot := range trainer.Run(context.Background()) {
+				final = snapshot
+			}
+			total += meanNonGoalValue(final)
+		}
+		return total / float64(len(seeds))
+	}
+
+	qOver := meanValue(AlgorithmQLearning) - truth
+	doubleOver := meanValue(AlgorithmDoubleQ) - truth
+	if qOver <= 0 {
+		t.Fatalf("expected q-learning to overestimate the random-walk value %.3f, got bias %.3f", truth, qOver)
+	}
+	if doubleOver >= qOver {
+		t.Fatalf("expected double q-learning bias %.3f to be below q-learning bias %.3f", doubleOver, qOver)
+	}
+}
+
+func meanNonGoalValue(snapshot Snapshot) float64 {
+	total := 0.0
+	count := 0
+	for r, row := range snapshot.ValueMap {
+		for c, v := range row {
+			if r == snapshot.Config.Goals[0].Row && c == snapshot.Config.Goals[0].Col {
+				continue
+			}
+			total += v
+			count++
+		}
+	}
+	return total / float64(count)
+}
+
+func meanRandomWalkValue(cfg Config, rollouts int) float64 {
+	env := NewTrainer(cfg).grid
+	env.setRandomSource(rand.New(rand.NewSource(99)))
+	goal := env.initialGoals[0]
+	total := 0.0
+	count := 0
+	for r := 0; r < env.rows; r++ {
+		for c := 0; c < env.cols; c++ {
+			if r == goal.Row && c == goal.Col {
+				continue
+			}
+			for i := 0; i < rollouts; i++ {
+				env.Reset()
+				env.currRow, env.currCol = r, c
+				ret, discount := 0.0, 1.0
+				for {
+					prevDistance := env.potential(env.currRow, env.currCol)
+					reward, done := env.Step(0)
+					reward += 0.1 * (prevDistance - env.potential(env.currRow, env.currCol))
+					ret += discount * reward
+					discount *= cfg.Gamma
+					if done {
+						break
+					}
+				}
+				total += ret
+				count++
+			}
+		}
+	}
+	return total / float64(count)
+}
+
+func TestDynaQWallSwitchSmoke(t *testing.T) {
+	cfg := Config{
+		Episodes:          40,
+		Seed:              7,
+		Algorithm:         AlgorithmDynaQPlus,
+		Rows:              4,
+		Cols:              4,
+		Goals:             []Goal{{Row: 0, Col: 3, Reward: 1}},
+		StepPenalty:       0.02,
+		Epsilon:           0.2,
+		Alpha:             0.5,
+		Gamma:             0.95,
+		PlanningSteps:     10,
+		DynaKappa:         0.001,
+		Walls:             []Position{{Row: 2, Col: 0}, {Row: 2, Col: 1}, {Row: 2, Col: 2}},
+		WallSwitchEpisode: 20,
+		SwitchedWalls:     []Position{{Row: 2, Col: 1}, {Row: 2, Col: 2}, {Row: 2, Col: 3}},
+	}
+
+	trainer := NewTrainer(cfg)
+	ctx := context.Background()
+
+	var final Snapshot
+	successesBeforeSwitch := 0
+	for snapshot := range trainer.Run(ctx) {
+		if snapshot.Status == StatusEpisodeComplete && snapshot.Episode == cfg.WallSwitchEpisode-1 {
+			successesBeforeSwitch = snapshot.SuccessCount
+		}
+		final = snapshot
+	}
+	lateSuccesses := final.SuccessCount - successesBeforeSwitch
+
+	if final.EpisodesCompleted != cfg.Episodes {
+		t.Fatalf("expected %d episodes completed, got %d", cfg.Episodes, final.EpisodesCompleted)
+	}
+	if len(final.Walls) != len(cfg.SwitchedWalls) {
+		t.Fatalf("expected %d walls after switch, got %d", len(cfg.SwitchedWalls), len(final.Walls))
+	}
+	for _, wall := range final.Walls {
+		if wall.Row == 2 && wall.Col == 0 {
+			t.Fatalf("expected wall at (2,0) to be removed after switch")
+		}
+	}
+	if lateSuccesses < 1 {
+		t.Fatalf("expected dyna-q-plus to find the new opening after the wall switch")
+	}
+}
+
+func TestValueErrorShrinksDuringTraining(t *testing.T) {
+	cfg := Config{
+		Episodes:        200,
+		Seed:            7,
+		Algorithm:       AlgorithmQLearning,
+		Rows:            4,
+		Cols:            4,
+		StepPenalty:     0.02,
+		Epsilon:         0.3,
+		Alpha:           0.3,
+		Gamma:           0.9,
+		TrackValueError: true,
+	}
+
+	trainer := NewTrainer(cfg)
+	var first, final *ValueError
+	for snapshot := range trainer.Run(context.Background()) {
+		if snapshot.ValueError == nil {
+			t.Fatalf("expected value error in %s snapshot", snapshot.Status)
+		}
+		if first == nil {
+			first = snapshot.ValueError
+		}
+		final = snapshot.ValueError
+	}
+
+	if final.RMSE >= first.RMSE {
+		t.Fatalf("expected RMSE to shrink, first=%.4f final=%.4f", first.RMSE, final.RMSE)
+	}
+	if final.PolicyAgreement < first.PolicyAgreement {
+		t.Fatalf("expected policy agreement to improve, first=%.1f final=%.1f", first.PolicyAgreement, final.PolicyAgreement)
+	}
+}
+
+func TestGoalAwareStateSeparatesCollectedGoals(t *testing.T) {
+	cfg := Config{
+		Episodes:       200,
+		Seed:           11,
+		Algorithm:      AlgorithmQLearning,
+		Rows:           4,
+		Cols:           4,
+		Goals:          []Goal{{Row: 0, Col: 3, Reward: 1}, {Row: 3, Col: 3, Reward: 1}},
+		StepPenalty:    0.02,
+		Epsilon:        0.2,
+		Alpha:          0.3,
+		Gamma:          0.9,
+		GoalAwareState: true,
+	}
+
+	trainer := NewTrainer(cfg)
+	if got, want := trainer.env.NumStates(), 4*4*4; got != want {
+		t.Fatalf("expected %d states with two goal bits, got %d", want, got)
+	}
+
+	env := trainer.grid
+	env.Reset()
+	env.currRow, env.currCol = 1, 3
+	before := env.State()
+	env.Step(0) // collect the goal at (0,3)
+	env.Step(2) // back to (1,3)
+	if env.State() == before {
+		t.Fatalf("expected state id to change after collecting a goal")
+	}
+	if env.StatePosition(env.State()) != env.StatePosition(before) {
+		t.Fatalf("expected both states to project onto the same cell")
+	}
+
+	var final Snapshot
+	for snapshot := range trainer.Run(context.Background()) {
+		final = snapshot
+	}
+	if final.SuccessCount < 1 {
+		t.Fatalf("expected at least one episode collecting both goals, got %d", final.SuccessCount)
+	}
+	if len(final.ValueMap) != cfg.Rows || len(final.ValueMap[0]) != cfg.Cols {
+		t.Fatalf("expected value map to stay %dx%d", cfg.Rows, cfg.Cols)
+	}
+}
+
+// recordingShaper pays a fixed bonus and counts how often it was asked for one.
+type recordingShaper struct {
+	calls int
+}
+
+func (r *recordingShaper) Shape(prevDistance, nextDistance float64, terminal bool) float64 {
+	r.calls++
+	return 0.5
+}
+
+func TestCoopShapesEachAgentsLearningReward(t *testing.T) {
+	shaper := &recordingShaper{}
+	cfg := Config{Env: EnvCoop, Episodes: 1, Seed: 2, Epsilon: 0.2, Alpha: 0.5, Gamma: 0.9, RewardShaper: shaper, SnapshotPolicy: SnapshotEpisodeEnd}
+	trainer := NewTrainer(cfg)
+	var episode Snapshot
+	for snapshot := range trainer.Run(context.Background()) {
+		if snapshot.Status == StatusEpisodeComplete {
+			episode = snapshot
+		}
+	}
+	if shaper.calls < episode.EpisodeSteps || episode.EpisodeShaping != 0.5*float64(shaper.calls) {
+		t.Fatalf("expected every agent step to be shaped, got %d calls over %d steps and %.2f shaping", shaper.calls, episode.EpisodeSteps, episode.EpisodeShaping)
+	}
+	// The bonus would add 0.5 per step to the team reward; it only steers learning.
+	maxTeamReward := 0.0
+	for _, goal := range episode.Goals {
+		maxTeamReward += goal.Reward
+	}
+	if episode.EpisodeReward > maxTeamReward {
+		t.Fatalf("expected the reported reward to exclude shaping, got %.2f above the goals' %.2f", episode.EpisodeReward, maxTeamReward)
+	}
+}
+
+func TestCoopAgentsLearnToHoldTheDoor(t *testing.T) {
+	env := newCoopEnv(4, 5, 0.02, 0)
+	env.positions[0] = position{row: env.door.row, col: env.door.col - 1}
+	env.step([coopAgents]int{1, 0})
+	if env.positions[0].col != env.door.col-1 {
+		t.Fatalf("expected the closed door to block the first agent")
+	}
+	env.positions[1] = env.switches[0]
+	env.step([coopAgents]int{1, 0})
+	if env.positions[0] != env.door {
+		t.Fatalf("expected the first agent to pass while its partner holds the switch")
+	}
+
+	cfg := Config{
+		Env:          EnvCoop,
+		Episodes:     1500,
+		Seed:         1,
+		Rows:         4,
+		Cols:         5,
+		Epsilon:      0.5,
+		EpsilonMin:   0.05,
+		EpsilonDecay: 0.997,
+		Alpha:        0.3,
+		Gamma:        0.95,
+	}
+	trainer := NewTrainer(cfg)
+	var final Snapshot
+	earlySuccesses := 0
+	for snapshot := range trainer.Run(context.Background()) {
+		final = snapshot
+		if snapshot.Status == StatusEpisodeComplete && snapshot.Episode == cfg.Episodes-200 {
+			earlySuccesses = snapshot.SuccessCount
+		}
+	}
+	lateSuccesses := final.SuccessCount - earlySuccesses
+	if len(final.Agents) != coopAgents || final.Door == nil {
+		t.Fatalf("expected snapshots to describe both agents and the door")
+	}
+	if lateSuccesses < 100 {
+		t.Fatalf("expected both agents to reach their goals in most late episodes, got %d/200", lateSuccesses)
+	}
+}
+
+func TestLoggerAndVisitsReplaceStdoutHeatmap(t *testing.T) {
+	trainer := NewTrainer(Config{Episodes: 3, Seed: 5, Algorithm: AlgorithmQLearning, Rows: 4, Cols: 4, Epsilon: 0.3, Alpha: 0.3, Gamma: 0.9})
+	var messages []string
+	trainer.SetLogger(LoggerFunc(func(level LogLevel, msg string) {
+		messages = append(messages, level.String()+": "+msg)
+	}), LogInfo)
+
+	completed := 0
+	for snapshot := range trainer.Run(context.Background()) {
+		if snapshot.Status != StatusEpisodeComplete {
+			if snapshot.Visits != nil {
+				t.Fatalf("expected visits only on episode_complete snapshots, got them on %s", snapshot.Status)
+			}
+			continue
+		}
+		completed++
+		total := 0
+		for _, row := range snapshot.Visits {
+			for _, count := range row {
+				total += count
+			}
+		}
+		if len(snapshot.Visits) != 4 || total != snapshot.EpisodeSteps+1 {
+			t.Fatalf("episode %d: expected start plus one visit per step (%d), got %d over %d rows", snapshot.Episode, snapshot.EpisodeSteps+1, total, len(snapshot.Visits))
+		}
+	}
+	if completed != 3 {
+		t.Fatalf("expected 3 completed episodes, got %d", completed)
+	}
+	if len(messages) != 0 {
+		t.Fatalf("expected debug episode messages to be filtered at info level, got %v", messages)
+	}
+
+	debug := NewTrainer(Config{Episodes: 2, Seed: 5, Rows: 4, Cols: 4})
+	messages = nil
+	debug.SetLogger(LoggerFunc(func(level LogLevel, msg string) {
+		messages = append(messages, level.String()+": "+msg)
+	}), LogDebug)
+	for range debug.Run(context.Background()) {
+	}
+	if len(messages) != 2 {
+		t.Fatalf("expected one debug message per episode, got %v", messages)
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Fatal("expected an unknown log level to be rejected")
+	}
+}
+
+func TestSnapshotPolicyThrottlesRunningSnapshots(t *testing.T) {
+	base := Config{Episodes: 10, Seed: 8, Algorithm: AlgorithmQLearning, Rows: 5, Cols: 5, Epsilon: 0.3, Alpha: 0.3, Gamma: 0.9}
+	collect := func(cfg Config) (map[string]int, []Snapshot) {
+		counts := map[string]int{}
+		var episodes []Snapshot
+		for snapshot := range NewTrainer(cfg).Run(context.Background()) {
+			counts[snapshot.Status]++
+			switch snapshot.Status {
+			case StatusRunning:
+				if cfg.SnapshotEvery > 1 && snapshot.Step%cfg.SnapshotEvery != 0 {
+					t.Fatalf("running snapshot at step %d with SnapshotEvery=%d", snapshot.Step, cfg.SnapshotEvery)
+				}
+			case StatusStep:
+				if snapshot.ValueMap != nil || snapshot.Goals != nil {
+					t.Fatal("expected step events to skip the value map and layout")
+				}
+			case StatusEpisodeComplete:
+				snapshot.Visits = nil
+				episodes = append(episodes, snapshot)
+			}
+		}
+		return counts, episodes
+	}
+
+	every, reference := collect(base)
+	totalSteps := reference[len(reference)-1].TotalSteps
+	if every[StatusRunning] != totalSteps {
+		t.Fatalf("expected one running snapshot per step (%d), got %d", totalSteps, every[StatusRunning])
+	}
+
+	episodeOnly := base
+	episodeOnly.SnapshotPolicy = SnapshotEpisodeEnd
+	counts, episodes := collect(episodeOnly)
+	if counts[StatusRunning] != 0 || counts[StatusStep] != 0 || counts[StatusEpisodeComplete] != 10 {
+		t.Fatalf("expected only episode snapshots, got %v", counts)
+	}
+	for i := range episodes {
+		if episodes[i].TotalReward != reference[i].TotalReward || episodes[i].TotalSteps != reference[i].TotalSteps {
+			t.Fatalf("episode %d: snapshot policy changed training", i+1)
+		}
+	}
+
+	throttled := base
+	throttled.SnapshotEvery = 7
+	throttled.StepEvents = true
+	counts, _ = collect(throttled)
+	if counts[StatusRunning] != totalSteps/7 || counts[StatusRunning]+counts[StatusStep] != totalSteps {
+		t.Fatalf("expected %d full snapshots and step events for the rest of %d steps, got %v", totalSteps/7, totalSteps, counts)
+	}
+}
+
+func TestQLearningStepLoopDoesNotAllocate(t *testing.T) {
+	allocs := func(steps int) float64 {
+		cfg := Config{
+			Episodes:       1,
+			Seed:           99,
+			Algorithm:      AlgorithmQLearning,
+			Rows:           6,
+			Cols:           6,
+			MaxSteps:       steps,
+			Epsilon:        0.2,
+			Alpha:          0.2,
+			Gamma:          0.9,
+			Goals:          []Goal{{Row: 0, Col: 5, Reward: 1}},
+			Walls:          []Position{{Row: 0, Col: 4}, {Row: 1, Col: 5}},
+			SnapshotPolicy: SnapshotEpisodeEnd,
+		}
+		return testing.AllocsPerRun(5, func() {
+			for range NewTrainer(cfg).Run(context.Background()) {
+			}
+		})
+	}
+	short, long := allocs(100), allocs(20000)
+	if long > short+2 {
+		t.Fatalf("expected allocations independent of episode length, got %.0f for 100 steps and %.0f for 20000", short, long)
+	}
+}
+
+func TestShapingIsReportedSeparately(t *testing.T) {
+	base := Config{Episodes: 5, Seed: 4, Algorithm: AlgorithmQLearning, Rows: 4, Cols: 5, Epsilon: 0.3, Alpha: 0.3, Gamma: 1, StepPenalty: 0.02, ShapingScale: 0.25}
+	for _, shaping := range []string{ShapingNone, ShapingPotential, ShapingDistance} {
+		cfg := base
+		cfg.Shaping = shaping
+		lastSuccess := 0
+		for snapshot := range NewTrainer(cfg).Run(context.Background()) {
+			if snapshot.Status != StatusEpisodeComplete {
+				continue
+			}
+			succeeded := snapshot.SuccessCount > lastSuccess
+			lastSuccess = snapshot.SuccessCount
+			// From the bottom-left start to the top-right goal the distance is 3+4 cells.
+			want := 0.0
+			switch shaping {
+			case ShapingPotential:
+				// With γ=1 the shaping telescopes to Φ(end)-Φ(start) whatever path was taken: Φ is 0 at the
+				// goal, but a timed-out episode keeps the potential of the cell it stopped on.
+				end := snapshot.Position
+				want = 0.25 * float64(7-end.Row-(4-end.Col))
+				if succeeded {
+					want = 0.25 * 7
+				}
+			case ShapingDistance:
+				// Progress telescopes to d(start)-d(end), which is the full distance only when the goal was reached.
+				if !succeeded {
+					continue
+				}
+				want = 0.25 * 7
+			}
+			if math.Abs(snapshot.EpisodeShaping-want) > 1e-9 {
+				t.Fatalf("%s episode %d: expected shaping %.3f, got %.3f", shaping, snapshot.Episode, want, snapshot.EpisodeShaping)
+			}
+		}
+	}
+}
+
+func TestPotentialShapingKeepsPotentialOnTimeouts(t *testing.T) {
+	// Three steps cannot cover the 7 cells to the goal, so every episode times out and the shaping sums to
+	// Φ(end)-Φ(start) = 0.25·(7-d(end)), never the 0.25·7 a zero terminal potential would give.
+	cfg := Config{Episodes: 5, Seed: 4, Algorithm: AlgorithmQLearning, Rows: 4, Cols: 5, MaxSteps: 3, Gamma: 1, Shaping: ShapingPotential, ShapingScale: 0.25}
+	for snapshot := range NewTrainer(cfg).Run(context.Background()) {
+		if snapshot.Status != StatusEpisodeComplete {
+			continue
+		}
+		end := snapshot.Position
+		want := 0.25 * float64(7-end.Row-(4-end.Col))
+		if math.Abs(snapshot.EpisodeShaping-want) > 1e-9 {
+			t.Fatalf("episode %d ending at %v: expected shaping %.3f, got %.3f", snapshot.Episode, end, want, snapshot.EpisodeShaping)
+		}
+	}
+}
+
+// fieldNames lists the fields of err's FieldErrors in order.
+func fieldNames(t *testing.T, err error) []string {
+	t.Helper()
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	var fields []string
+	for _, field := range validation.Fields {
+		fields = append(fields, field.Field)
+	}
+	return fields
+}
+
+func TestValidateReportsEveryInvalidField(t *testing.T) {
+	if err := (Config{Epsilon: 0.1, Alpha: 0.1, Gamma: 0.9}).Validate(); err != nil {
+		t.Fatalf("expected the other zero fields to select defaults, got %v", err)
+	}
+	cfg := Config{
+		Algorithm:   "bogus",
+		Epsilon:     1.5,
+		EpsilonMin:  -0.1,
+		Alpha:       0.5,
+		Gamma:       2,
+		StepPenalty: -1,
+		Rows:        4,
+		Cols:        4,
+		Goals:       []Goal{{Row: 4, Col: 0, Reward: 1}},
+		Slips:       []SlipTile{{Row: 1, Col: 1, Probability: 2}},
+	}
+	err := cfg.Validate()
+	want := []string{"gamma", "stepPenalty", "goals[0]", "slips[0]", "algorithm", "epsilon", "epsilonMin"}
+	if fields := fieldNames(t, err); !reflect.DeepEqual(fields, want) {
+		t.Fatalf("expected errors for %v, got %v", want, fields)
+	}
+	var field *FieldError
+	if !errors.As(err, &field) || field.Field != "gamma" {
+		t.Fatalf("expected errors.As to find the first FieldError, got %v", field)
+	}
+	if trainer, err := NewTrainerStrict(cfg); trainer != nil || err == nil {
+		t.Fatal("expected NewTrainerStrict to refuse an invalid config")
+	}
+	if _, err := NewTrainerStrict(Config{Episodes: 1, Algorithm: AlgorithmSARSA, Epsilon: 0.1, Alpha: 0.1, Gamma: 0.9}); err != nil {
+		t.Fatalf("expected a valid config to build a trainer, got %v", err)
+	}
+	// Solve only reads the board and gamma, so the learner fields are left out of its check.
+	if err := (Config{Gamma: 0.9, Rows: 4, Cols: 4, Goals: []Goal{{Row: 3, Col: 3, Reward: 1}}}).ValidateEnvironment(); err != nil {
+		t.Fatalf("expected a board without learner settings to be valid, got %v", err)
+	}
+	want = []string{"gamma", "stepPenalty", "goals[0]", "slips[0]"}
+	if fields := fieldNames(t, cfg.ValidateEnvironment()); !reflect.DeepEqual(fields, want) {
+		t.Fatalf("expected environment errors for %v, got %v", want, fields)
+	}
+}
+
+func TestValidateRejectsSettingsNewTrainerWouldReplace(t *testing.T) {
+	// Zero epsilon, alpha and gamma would become 0.1, 0.1 and 0.9, and the coop board always trains
+	// Q-learners on its own fixed layout.
+	cfg := Config{
+		Env:       EnvCoop,
+		Algorithm: AlgorithmSARSA,
+		Rows:      4,
+		Cols:      5,
+		GoalCount: 2,
+		Goals:     []Goal{{Row: 0, Col: 0, Reward: 1}},
+		Walls:     []Position{{Row: 1, Col: 1}},
+	}
+	want := []string{"gamma", "goalCount", "goals", "walls", "algorithm", "epsilon", "alpha"}
+	if fields := fieldNames(t, cfg.Validate()); !reflect.DeepEqual(fields, want) {
+		t.Fatalf("expected errors for %v, got %v", want, fields)
+	}
+	if err := (Config{Env: EnvCoop, Algorithm: AlgorithmQLearning, Epsilon: 0.1, Alpha: 0.1, Gamma: 0.9}).Validate(); err != nil {
+		t.Fatalf("expected q-learning on the coop board to be valid, got %v", err)
+	}
+
+	// Softmax and UCB never read ε, so a zero epsilon with the CLI's epsilon floor is fine there.
+	for _, exploration := range []string{ExplorationSoftmax, ExplorationUCB} {
+		cfg := Config{Episodes: 5, Exploration: exploration, EpsilonMin: 0.05, Alpha: 0.1, Gamma: 0.9}
+		if _, err := NewTrainerStrict(cfg); err != nil {
+			t.Fatalf("expected %s without epsilon to be valid, got %v", exploration, err)
+		}
+	}
+	epsilonGreedy := Config{Exploration: ExplorationEpsilonGreedy, EpsilonMin: 0.05, Alpha: 0.1, Gamma: 0.9}
+	if fields := fieldNames(t, epsilonGreedy.Validate()); !reflect.DeepEqual(fields, []string{"epsilon", "epsilonMin"}) {
+		t.Fatalf("expected ε-greedy to still require epsilon, got %v", fields)
+	}
+
+	// Auto-placed goals replace the manual ones.
+	gridworld := Config{Epsilon: 0.1, Alpha: 0.1, Gamma: 0.9, GoalCount: 2, Goals: []Goal{{Row: 0, Col: 3, Reward: 1}}}
+	if fields := fieldNames(t, gridworld.Validate()); !reflect.DeepEqual(fields, []string{"goals"}) {
+		t.Fatalf("expected an error for goals next to goalCount, got %v", fields)
+	}
+}
+
+func TestConfigJSONUsesStableKeys(t *testing.T) {
+	cfg := Config{
+		Algorithm:             AlgorithmSARSALambda,
+		EpsilonMin:            0.05,
+		SoftmaxMinTemperature: 0.1,
+		StepDelayMs:           10,
+		Goals:                 []Goal{{Row: 0, Col: 3, Reward: 1}},
+		Slips:                 []SlipTile{{Row: 1, Col: 1, Probability: 0.2}},
+		RewardShaper:          NoShaping{},
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"algorithm":"sarsa-lambda"`, `"epsilonMin":0.05`, `"softmaxMinTemperature":0.1`, `"stepDelayMs":10`, `"goals":[{"row":0,"col":3,"reward":1}]`, `"probability":0.2`} {
+		if !strings.Contains(string(data), key) {
+			t.Fatalf("expected %s in %s", key, data)
+		}
+	}
+	var decoded Config
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	cfg.RewardShaper = nil
+	if !reflect.DeepEqual(decoded, cfg) {
+		t.Fatalf("config did not survive a JSON round trip:\n got %+v\nwant %+v", decoded, cfg)
+	}
+}
+
+func TestSoftmaxQActionFollowsBoltzmannProbabilities(t *testing.T) {
+	q := newQTable(1, 3)
+	q.set(0, 0, 1)
+	q.set(0, 1, 0)
+	q.set(0, 2, -1)
+	agent := newEpsilonGreedyAgent(rand.New(rand.NewSource(5)), nil, q, 0)
+	agent.explore(Config{Exploration: ExplorationSoftmax, SoftmaxTemperature: 0.5})
+	const draws = 20000
+	var counts [3]int
+	for i := 0; i < draws; i++ {
+		counts[agent.softmaxQAction(0)]++
+	}
+	sum := math.Exp(2) + 1 + math.Exp(-2)
+	for action, weight := range []float64{math.Exp(2), 1, math.Exp(-2)} {
+		got := float64(counts[action]) / draws
+		if want := weight / sum; math.Abs(got-want) > 0.01 {
+			t.Fatalf("action %d chosen %.3f of the time, want %.3f", action, got, want)
+		}
+	}
+	want := (math.Exp(2)*1 + math.Exp(-2)*-1) / sum
+	if got := agent.expectedQValue(0); math.Abs(got-want) > 1e-12 {
+		t.Fatalf("expected Boltzmann expectation %.6f, got %.6f", want, got)
+	}
+}
+
+func TestSoftmaxExplorationTrainsEveryAlgorithm(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmMonteCarlo, AlgorithmQLearning, AlgorithmSARSA, AlgorithmExpectedSARSA} {
+		cfg := Config{
+			Episodes:              150,
+			Seed:                  3,
+			Algorithm:             algorithm,
+			Exploration:           ExplorationSoftmax,
+			SoftmaxTemperature:    1,
+			SoftmaxMinTemperature: 0.1,
+			SoftmaxDecay:          0.95,
+			Alpha:                 0.3,
+			SnapshotPolicy:        SnapshotEpisodeEnd,
+		}
+		var temperatures []float64
+		successes := 0
+		lastSuccessCount := 0
+		for snapshot := range NewTrainer(cfg).Run(context.Background()) {
+			if snapshot.Status != StatusEpisodeComplete {
+				continue
+			}
+			temperatures = append(temperatures, snapshot.Temperature)
+			if snapshot.Episode > cfg.Episodes-20 && snapshot.SuccessCount > lastSuccessCount {
+				successes++
+			}
+			lastSuccessCount = snapshot.SuccessCount
+		}
+		if temperatures[0] != 1 || math.Abs(temperatures[1]-0.95) > 1e-12 || temperatures[len(temperatures)-1] != 0.1 {
+			t.Fatalf("%s: expected the temperature to decay from 1 by 0.95 down to 0.1, got %v...%v", algorithm, temperatures[:2], temperatures[len(temperatures)-1])
+		}
+		if successes < 18 {
+			t.Fatalf("%s: expected the annealed softmax policy to reach the goal in most of the last 20 episodes, got %d", algorithm, successes)
+		}
+	}
+	greedy := NewTrainer(Config{Episodes: 1, Algorithm: AlgorithmQLearning})
+	if snapshot := drain(greedy); snapshot.Temperature != 0 {
+		t.Fatalf("expected ε-greedy snapshots to report no temperature, got %.3f", snapshot.Temperature)
+	}
+}
+
+func TestUCBTriesEveryActionThenFollowsTheBound(t *testing.T) {
+	q := newQTable(1, 3)
+	agent := newEpsilonGreedyAgent(rand.New(rand.NewSource(1)), nil, q, 0)
+	agent.explore(Config{Exploration: ExplorationUCB, UCBConstant: 1})
+	seen := map[int]bool{}
+	for i := 0; i < 3; i++ {
+		seen[agent.actInState(0)] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected UCB to try all 3 actions first, got %v", seen)
+	}
+	// Action 0 is worth more but was tried 20 times; √(ln 24 / 2) outweighs a 0.5 value gap.
+	q.set(0, 0, 0.5)
+	agent.qVisits.counts[0], agent.qVisits.counts[1], agent.qVisits.counts[2] = 20, 2, 2
+	counts := [3]int{}
+	for i := 0; i < 100; i++ {
+		counts[agent.ucbQAction(0)]++
+	}
+	if counts[0] != 0 || counts[1] == 0 || counts[2] == 0 {
+		t.Fatalf("expected UCB to split between the rarely tried actions, got %v", counts)
+	}
+	if got := agent.expectedQValue(0); got != 0 {
+		t.Fatalf("expected Expected SARSA under UCB to average the UCB choices, got %.3f", got)
+	}
+}
+
+func TestCountBonusHelpsOnSparseBoards(t *testing.T) {
+	successes := func(countBonus float64) int {
+		cfg := Config{
+			Episodes:       100,
+			Seed:           2,
+			Algorithm:      AlgorithmQLearning,
+			Rows:           20,
+			Cols:           20,
+			Goals:          []Goal{{Row: 19, Col: 19, Reward: 5}},
+			MaxSteps:       200,
+			Epsilon:        0.1,
+			Alpha:          0.2,
+			Shaping:        ShapingNone,
+			CountBonus:     countBonus,
+			SnapshotPolicy: SnapshotEpisodeEnd,
+		}
+		final := drain(NewTrainer(cfg))
+		if final.TotalReward != 5*float64(final.SuccessCount) {
+			t.Fatalf("expected reported rewards to exclude the count bonus, got %.3f for %d successes", final.TotalReward, final.SuccessCount)
+		}
+		return final.SuccessCount
+	}
+	plain, bonus := successes(0), successes(0.1)
+	if bonus <= 2*plain {
+		t.Fatalf("expected the count bonus to more than double successes on a 20x20 board, got %d vs %d", bonus, plain)
+	}
+}
+
+func TestCountBonusFadesAndQApproachesOptimal(t *testing.T) {
+	cfg := Config{
+		Episodes:        3000,
+		Seed:            3,
+		Algorithm:       AlgorithmQLearning,
+		Rows:            3,
+		Cols:            3,
+		Epsilon:         0.5,
+		EpsilonMin:      0.5,
+		Alpha:           0.2,
+		Gamma:           0.9,
+		StepPenalty:     0.02,
+		CountBonus:      0.1,
+		TrackValueError: true,
+		SnapshotPolicy:  SnapshotEpisodeEnd,
+	}
+	trainer := NewTrainer(cfg)
+	if got := trainer.qvalues.get(0, 0); math.Abs(got-1) > 1e-9 {
+		t.Fatalf("expected Q-values to start at β/(1−γ) = 1, got %.3f", got)
+	}
+	var early *ValueError
+	for snapshot := range trainer.Run(context.Background()) {
+		if snapshot.Episode == 200 && early == nil {
+			early = snapshot.ValueError
+		}
+	}
+	final := trainer.valueError()
+
+	// The bonus is positive and shrinks with every visit instead of turning into a step cost.
+	visits := trainer.agent.qVisits.get(0, 1)
+	if bonus := trainer.countBonus(trainer.agent, 0, 1); bonus <= 0 || bonus > 0.1/math.Sqrt(float64(visits))+1e-12 || visits < 100 {
+		t.Fatalf("expected a fading positive bonus after %d visits, got %.4f", visits, bonus)
+	}
+	if final.RMSE >= early.RMSE || final.RMSE > 0.02 || final.PolicyAgreement != 100 {
+		t.Fatalf("expected Q to approach Q*, RMSE %.4f after 200 episodes and %.4f at the end (agreement %.1f%%)", early.RMSE, final.RMSE, final.PolicyAgreement)
+	}
+}
+
+func TestSchedulesMoveTowardsTheirFinalValue(t *testing.T) {
+	cases := []struct {
+		spec string
+		n    int
+		want float64
+	}{
+		{"constant", 50, 1},
+		{"linear,final=0.2,episodes=100", 50, 0.6},
+		{"linear,final=0.2,episodes=100", 500, 0.2},
+		{"cosine,final=0.2,episodes=100", 50, 0.6},
+		{"cosine,final=0.2,episodes=100", 100, 0.2},
+		{"exponential,final=0.1,decay=0.5", 2, 0.25},
+		{"exponential,final=0.1,decay=0.5", 10, 0.1},
+		{"step,decay=0.5,episodes=10", 19, 0.5},
+		{"step,decay=0.5,episodes=10", 20, 0.25},
+		{"step", 50, 0.03125},
+		{"inverse", 3, 0.25},
+		{"linear,final=2,episodes=10", 5, 1.5},
+	}
+	for _, c := range cases {
+		schedule, err := ParseSchedule(c.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q): %v", c.spec, err)
+		}
+		schedule = normalizeSchedule(schedule, 0, 0, 100)
+		if got := schedule.value(1, c.n); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("%s after %d: got %.4f, want %.4f", c.spec, c.n, got, c.want)
+		}
+	}
+	for _, spec := range []string{"", "sigmoid", "linear,final", "linear,floor=0.1", "step,episodes=ten"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("expected ParseSchedule(%q) to fail", spec)
+		}
+	}
+}
+
+func TestSnapshotsReportScheduledEpsilonAndAlpha(t *testing.T) {
+	cfg := Config{
+		Episodes:        40,
+		Seed:            3,
+		Algorithm:       AlgorithmQLearning,
+		Epsilon:         0.5,
+		EpsilonSchedule: Schedule{Kind: ScheduleLinear, Final: 0.1, Episodes: 20},
+		Alpha:           0.4,
+		AlphaSchedule:   Schedule{Kind: ScheduleInverse},
+		SnapshotPolicy:  SnapshotEpisodeEnd,
+	}
+	var snapshots []Snapshot
+	for snapshot := range NewTrainer(cfg).Run(context.Background()) {
+		if snapshot.Status == StatusEpisodeComplete {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	// Episode 11 explores with the value reached after 10 of the 20 linear episodes.
+	if got := snapshots[10].Epsilon; math.Abs(got-0.3) > 1e-9 {
+		t.Fatalf("expected epsilon 0.3 in episode 11, got %.4f", got)
+	}
+	if got := snapshots[len(snapshots)-1].Epsilon; got != 0.1 {
+		t.Fatalf("expected epsilon to stop at 0.1, got %.4f", got)
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Alpha <= 0 || snapshot.Alpha > 0.4 {
+			t.Fatalf("expected inverse alpha within (0, 0.4], got %.4f", snapshot.Alpha)
+		}
+	}
+	if last := snapshots[len(snapshots)-1].Alpha; last >= 0.4 {
+		t.Fatalf("expected inverse alpha to shrink with visits, got %.4f", last)
+	}
+}
+
+func TestInverseAlphaKeepsEveryAlgorithmFinite(t *testing.T) {
+	algorithms := []string{AlgorithmMonteCarlo, AlgorithmOffPolicyMonteCarlo, AlgorithmQLearning, AlgorithmDoubleQ, AlgorithmDynaQ, AlgorithmDynaQPlus, AlgorithmSARSA, AlgorithmExpectedSARSA, AlgorithmSARSALambda, AlgorithmQLambda, AlgorithmNStepSARSA, AlgorithmTreeBackup}
+	for _, algorithm := range algorithms {
+		trainer := NewTrainer(Config{
+			Episodes:      60,
+			Seed:          5,
+			Algorithm:     algorithm,
+			Epsilon:       0.3,
+			Alpha:         0.5,
+			AlphaSchedule: Schedule{Kind: ScheduleInverse},
+			Gamma:         0.9,
+			PlanningSteps: 5,
+			DynaKappa:     0.01,
+		})
+		drain(trainer)
+		checkpoint := trainer.Checkpoint()
+		// Dyna-Q+ plans with actions it has never tried, so some updates see no earlier visit.
+		for _, table := range append(checkpoint.QValues, checkpoint.DoubleQ...) {
+			for state, row := range table {
+				for action, value := range row {
+					if math.IsNaN(value) || math.IsInf(value, 0) {
+						t.Fatalf("%s: Q(%d,%d) = %v", algorithm, state, action, value)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestMonteCarloFirstAndEveryVisitReturns(t *testing.T) {
+	// State 0 is visited at steps 0 and 2; with γ=0.5 the returns from there are 0.25 and 1.
+	states, actions, rewards := []int{0, 1, 0}, []int{0, 0, 0}, []float64{0, 0, 1}
+	for _, c := range []struct {
+		everyVisit bool
+		want       float64
+	}{
+		{false, 0.125},
+		{true, 0.375},
+	} {
+		trainer := NewTrainer(Config{Algorithm: AlgorithmMonteCarlo, Alpha: 0.5, Gamma: 0.5, EveryVisit: c.everyVisit})
+		trainer.updateMonteCarloQ(states, actions, rewards)
+		if got := trainer.qvalues.get(0, 0); got != c.want {
+			t.Fatalf("everyVisit=%t: expected Q(0,0)=%.3f, got %.3f", c.everyVisit, c.want, got)
+		}
+	}
+}
+
+func TestOffPolicyMonteCarloImportanceSampling(t *testing.T) {
+	// The behaviour policy took action 1 in state 0 with probability 0.25, then action 2 in state 1 with
+	// probability 0.5. Once Q(1,2) is updated the greedy target picks it for sure, so W=1/0.5 for step 0.
+	states, actions, rewards, probabilities := []int{0, 1}, []int{1, 2}, []float64{0, 1}, []float64{0.25, 0.5}
+	for _, c := range []struct {
+		sampling string
+		want     float64
+	}{
+		{ImportanceWeighted, 1},
+		{ImportanceOrdinary, 2},
+	} {
+		trainer := NewTrainer(Config{Algorithm: AlgorithmOffPolicyMonteCarlo, Gamma: 1, ImportanceSampling: c.sampling})
+		trainer.updateOffPolicyMonteCarloQ(states, actions, rewards, probabilities)
+		if got := trainer.qvalues.get(0, 1); got != c.want {
+			t.Fatalf("%s: expected Q(0,1)=%.1f, got %.3f", c.sampling, c.want, got)
+		}
+	}
+
+	cfg := Config{Episodes: 300, Seed: 5, Algorithm: AlgorithmOffPolicyMonteCarlo, Epsilon: 0.3, SnapshotPolicy: SnapshotEpisodeEnd}
+	trainer := NewTrainer(cfg)
+	drain(trainer)
+	if eval := trainer.Evaluate(20, 1); eval.SuccessRate != 1 {
+		t.Fatalf("expected the learned greedy policy to always reach the goal, got success rate %.2f", eval.SuccessRate)
+	}
+}
+
+func TestActionProbabilitiesSumToOne(t *testing.T) {
+	for _, exploration := range []string{ExplorationEpsilonGreedy, ExplorationSoftmax, ExplorationUCB} {
+		q := newQTable(1, 4)
+		q.set(0, 0, 1)
+		q.set(0, 2, 1)
+		agent := newEpsilonGreedyAgent(rand.New(rand.NewSource(1)), nil, q, 0.2)
+		agent.explore(Config{Exploration: exploration, SoftmaxTemperature: 0.5, UCBConstant: 1})
+		agent.recordProbability = true
+		for i := 0; i < 6; i++ {
+			sum := 0.0
+			for action := 0; action < 4; action++ {
+				sum += agent.actionProbability(0, action)
+			}
+			if math.Abs(sum-1) > 1e-9 {
+				t.Fatalf("%s: expected action probabilities to sum to 1, got %.6f", exploration, sum)
+			}
+			chosen := agent.actInState(0)
+			if agent.probability <= 0 {
+				t.Fatalf("%s: expected the chosen action %d to have a positive probability", exploration, chosen)
+			}
+		}
+	}
+}
+
+func TestNStepBackups(t *testing.T) {
+	// Two steps from state 0: reward 1 into state 1 (taking the non-greedy action 3), then reward 2 into
+	// state 2, where the behaviour policy picked action 0 and the greedy action 1 is worth 4.
+	for _, c := range []struct {
+		algorithm string
+		want      float64
+	}{
+		{AlgorithmNStepSARSA, 1 + 0.5*(2+0.5*2)},
+		{AlgorithmTreeBackup, 1 + 0.5*6},
+	} {
+		trainer := NewTrainer(Config{Algorithm: c.algorithm, NSteps: 2, Alpha: 1, Gamma: 0.5})
+		trainer.qvalues.set(1, 0, 6)
+		trainer.qvalues.set(2, 0, 2)
+		trainer.qvalues.set(2, 1, 4)
+		trainer.nstep.store(0, 0, 0)
+		trainer.nstep.storeReward(1, 1)
+		trainer.nstep.store(1, 1, 3)
+		trainer.nstep.storeReward(2, 2)
+		trainer.nstep.store(2, 2, 0)
+		trainer.updateNStep(0, 2, true)
+		if got := trainer.qvalues.get(0, 0); got != c.want {
+			t.Fatalf("%s: expected Q(0,0)=%.2f, got %.2f", c.algorithm, c.want, got)
+		}
+	}
+}
+
+func TestTreeBackupWeighsByTheTargetPolicy(t *testing.T) {
+	// State 1 ties actions 0 and 1 at 6, so the greedy target policy takes the behaviour's action 0 half
+	// the time: G = 1 + 0.5*(0.5*6 + 0.5*(2 + 0.5*4)). How likely the behaviour policy was to pick it
+	// must not matter.
+	want := 1 + 0.5*(0.5*6+0.5*(2+0.5*4))
+	for _, cfg := range []Config{
+		{Epsilon: 0.05},
+		{Epsilon: 0.9},
+		{Exploration: ExplorationSoftmax, SoftmaxTemperature: 5},
+	} {
+		cfg.Algorithm, cfg.NSteps, cfg.Alpha, cfg.Gamma = AlgorithmTreeBackup, 2, 1, 0.5
+		trainer := NewTrainer(cfg)
+		trainer.qvalues.set(1, 0, 6)
+		trainer.qvalues.set(1, 1, 6)
+		trainer.qvalues.set(2, 1, 4)
+		trainer.nstep.store(0, 0, 0)
+		trainer.nstep.storeReward(1, 1)
+		trainer.nstep.store(1, 1, 0)
+		trainer.nstep.storeReward(2, 2)
+		trainer.nstep.store(2, 2, 3)
+		trainer.updateNStep(0, 2, true)
+		if got := trainer.qvalues.get(0, 0); math.Abs(got-want) > 1e-12 {
+			t.Fatalf("%s behaviour: expected Q(0,0)=%.3f, got %.3f", trainer.cfg.Exploration, want, got)
+		}
+	}
+}
+
+// corridorEnv moves right whatever the action and pays the number of the cell it enters, so every episode
+// follows the same trajectory with rewards 1, 2, ..., length-1.
+type corridorEnv struct{ chainEnv }
+
+func (c *corridorEnv) Step(int) (float64, bool) {
+	c.steps++
+	c.pos++
+	return float64(c.pos), c.pos == c.length-1
+}
+
+func TestNStepSARSAReturnsOnADeterministicTrajectory(t *testing.T) {
+	cfg := Config{Episodes: 1, Seed: 3, Algorithm: AlgorithmNStepSARSA, NSteps: 3, Epsilon: 0.3, Alpha: 1, Gamma: 0.5, Shaping: ShapingNone}
+	trainer := NewTrainerWithEnvironment(cfg, &corridorEnv{chainEnv{length: 5}})
+	drain(trainer)
+	// Step 3 backs up state 0 from Q(3, ·) = 0 and the terminal step 4 backs up state 1; the last n-1 = 2
+	// pairs are only backed up once the episode is over.
+	want := []float64{1 + 0.5*2 + 0.25*3, 2 + 0.5*3 + 0.25*4, 3 + 0.5*4, 4}
+	for state, value := range want {
+		if got := trainer.qvalues.maxValue(state); math.Abs(got-value) > 1e-12 {
+			t.Fatalf("expected state %d's taken pair to hold the %d-step return %.3f, got %.3f", state, cfg.NSteps, value, got)
+		}
+	}
+
+	// With n=1 the n-step return is SARSA's one-step target.
+	cfg.Episodes, cfg.Alpha = 5, 0.5
+	cfg.Algorithm = AlgorithmSARSA
+	sarsa := NewTrainerWithEnvironment(cfg, &corridorEnv{chainEnv{length: 5}})
+	drain(sarsa)
+	cfg.Algorithm, cfg.NSteps = AlgorithmNStepSARSA, 1
+	nstep := NewTrainerWithEnvironment(cfg, &corridorEnv{chainEnv{length: 5}})
+	drain(nstep)
+	if !reflect.DeepEqual(nstep.qvalues.data, sarsa.qvalues.data) {
+		t.Fatalf("expected n-step SARSA with n=1 to learn SARSA's Q-values on the corridor")
+	}
+}
+
+func TestNStepMethodsTrain(t *testing.T) {
+	// With n=1, n-step SARSA is one-step SARSA, down to the random draws.
+	cfg := Config{Episodes: 60, Seed: 9, Epsilon: 0.3, Alpha: 0.3, Slips: []SlipTile{{Row: 1, Col: 1, Probability: 0.2}}}
+	cfg.Algorithm = AlgorithmSARSA
+	sarsa := NewTrainer(cfg)
+	want := drain(sarsa)
+	cfg.Algorithm, cfg.NSteps = AlgorithmNStepSARSA, 1
+	nstep := NewTrainer(cfg)
+	got := drain(nstep)
+	if got.TotalReward != want.TotalReward || got.TotalSteps != want.TotalSteps {
+		t.Fatalf("expected n-step SARSA with n=1 to repeat SARSA's run, got reward %.3f in %d steps vs %.3f in %d", got.TotalReward, got.TotalSteps, want.TotalReward, want.TotalSteps)
+	}
+	if !reflect.DeepEqual(nstep.qvalues.data, sarsa.qvalues.data) {
+		t.Fatalf("expected n-step SARSA with n=1 to learn SARSA's Q-values")
+	}
+	for _, algorithm := range []string{AlgorithmNStepSARSA, AlgorithmTreeBackup} {
+		cfg.Episodes, cfg.Algorithm, cfg.NSteps = 200, algorithm, 4
+		trainer := NewTrainer(cfg)
+		drain(trainer)
+		if eval := trainer.Evaluate(20, 1); eval.SuccessRate < 0.9 {
+			t.Fatalf("%s: expected the greedy policy to reach the goal, got success rate %.2f", algorithm, eval.SuccessRate)
+		}
+	}
+}
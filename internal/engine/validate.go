@@ -0,0 +1,267 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError explains why one Config field is invalid. Field is the key the field has in JSON configs,
+// with an index for list entries such as "goals[1]".
+type FieldError struct {
+	Field  string
+	Value  any
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %s (got %v)", e.Field, e.Reason, e.Value)
+}
+
+// ValidationError lists every invalid field of a Config. errors.As also finds the individual FieldErrors.
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		parts[i] = field.Error()
+	}
+	return "invalid config: " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Fields))
+	for i, field := range e.Fields {
+		errs[i] = field
+	}
+	return errs
+}
+
+// Validate reports settings NewTrainer would otherwise clamp, drop or replace: out-of-range values, tiles
+// off the board, and board settings that the coop environment or auto-placed goals override. Zero values
+// that select a default, such as Rows, are valid; Epsilon, Alpha and Gamma must be set, because a zero
+// there reads as "never explore", "never learn" or "ignore the future" but would select 0.1, 0.1 and 0.9.
+// Epsilon and its decay settings are only checked under ε-greedy exploration, the one strategy reading them.
+func (cfg Config) Validate() error {
+	v := &validator{}
+	v.environment(cfg)
+	v.learner(cfg)
+	return v.err()
+}
+
+// ValidateEnvironment is Validate restricted to the task itself: the board, its rewards and shaping, and
+// Gamma. Those are all Solve reads, so planning needs no exploration or learning settings.
+func (cfg Config) ValidateEnvironment() error {
+	v := &validator{}
+	v.environment(cfg)
+	return v.err()
+}
+
+func (v *validator) environment(cfg Config) {
+	switch cfg.Env {
+	case "", EnvGridworld, EnvCoop:
+	default:
+		v.fail("env", cfg.Env, "must be gridworld or coop")
+	}
+	v.nonNegativeInt("rows", cfg.Rows)
+	v.nonNegativeInt("cols", cfg.Cols)
+	v.nonNegativeInt("maxSteps", cfg.MaxSteps)
+	v.positiveUnit("gamma", cfg.Gamma)
+	v.nonNegative("stepPenalty", cfg.StepPenalty)
+	v.nonNegativeInt("goalCount", cfg.GoalCount)
+	v.nonNegativeInt("goalInterval", cfg.GoalInterval)
+	v.nonNegativeInt("wallSwitchEpisode", cfg.WallSwitchEpisode)
+	v.nonNegativeInt("warmupEpisodes", cfg.WarmupEpisodes)
+	v.nonNegative("warmupStepPenalty", cfg.WarmupStepPenalty)
+	switch cfg.Shaping {
+	case "", ShapingDistance, ShapingPotential, ShapingNone:
+	default:
+		v.fail("shaping", cfg.Shaping, "must be distance, potential or none")
+	}
+	v.nonNegative("shapingScale", cfg.ShapingScale)
+
+	if cfg.Env == EnvCoop {
+		// The coop board has a fixed layout of its own; only its size is configurable.
+		if cfg.Rows > 0 && cfg.Rows < 3 {
+			v.fail("rows", cfg.Rows, "must be at least 3 on the coop board")
+		}
+		if cfg.Cols > 0 && cfg.Cols < 5 {
+			v.fail("cols", cfg.Cols, "must be at least 5 on the coop board")
+		}
+		if cfg.GoalCount != 0 {
+			v.fail("goalCount", cfg.GoalCount, "is not supported on the coop board")
+		}
+		for _, tiles := range []struct {
+			field string
+			count int
+		}{{"goals", len(cfg.Goals)}, {"walls", len(cfg.Walls)}, {"switchedWalls", len(cfg.SwitchedWalls)}, {"slips", len(cfg.Slips)}} {
+			if tiles.count > 0 {
+				v.fail(tiles.field, tiles.count, "are not supported on the coop board")
+			}
+		}
+		return
+	}
+
+	rows, cols := cfg.Rows, cfg.Cols
+	defaultRows, defaultCols := DefaultBoardSize(cfg.Env)
+	if rows <= 0 {
+		rows = defaultRows
+	}
+	if cols <= 0 {
+		cols = defaultCols
+	}
+	if cfg.GoalCount > 0 {
+		if len(cfg.Goals) > 0 {
+			v.fail("goals", len(cfg.Goals), "are replaced by the goalCount auto-placed goals")
+		}
+	} else {
+		for i, goal := range cfg.Goals {
+			field := fmt.Sprintf("goals[%d]", i)
+			v.onBoard(field, Position{Row: goal.Row, Col: goal.Col}, rows, cols)
+			if goal.Reward == 0 {
+				v.fail(field, goal, "must have a non-zero reward")
+			}
+		}
+	}
+	for i, wall := range cfg.Walls {
+		v.onBoard(fmt.Sprintf("walls[%d]", i), wall, rows, cols)
+	}
+	for i, wall := range cfg.SwitchedWalls {
+		v.onBoard(fmt.Sprintf("switchedWalls[%d]", i), wall, rows, cols)
+	}
+	for i, slip := range cfg.Slips {
+		field := fmt.Sprintf("slips[%d]", i)
+		v.onBoard(field, Position{Row: slip.Row, Col: slip.Col}, rows, cols)
+		if slip.Probability < 0 || slip.Probability > 1 {
+			v.fail(field, slip.Probability, "must have a probability between 0 and 1")
+		}
+	}
+}
+
+func (v *validator) learner(cfg Config) {
+	switch cfg.Algorithm {
+	case "", AlgorithmMonteCarlo, AlgorithmOffPolicyMonteCarlo, AlgorithmQLearning, AlgorithmDoubleQ, AlgorithmDynaQ, AlgorithmDynaQPlus, AlgorithmSARSA, AlgorithmExpectedSARSA, AlgorithmSARSALambda, AlgorithmQLambda, AlgorithmNStepSARSA, AlgorithmTreeBackup:
+	default:
+		v.fail("algorithm", cfg.Algorithm, "is not a supported algorithm")
+	}
+	if cfg.Env == EnvCoop && cfg.Algorithm != "" && cfg.Algorithm != AlgorithmQLearning {
+		v.fail("algorithm", cfg.Algorithm, "must be q-learning on the coop board")
+	}
+	switch cfg.ImportanceSampling {
+	case "", ImportanceWeighted, ImportanceOrdinary:
+	default:
+		v.fail("importanceSampling", cfg.ImportanceSampling, "must be weighted or ordinary")
+	}
+	v.nonNegativeInt("episodes", cfg.Episodes)
+	v.nonNegativeInt("stepDelayMs", cfg.StepDelayMs)
+	// Softmax and UCB never read ε, so its settings only matter under ε-greedy exploration.
+	if cfg.Exploration == "" || cfg.Exploration == ExplorationEpsilonGreedy {
+		v.positiveUnit("epsilon", cfg.Epsilon)
+		if cfg.EpsilonMin < 0 || cfg.EpsilonMin > max(cfg.Epsilon, 0) {
+			v.fail("epsilonMin", cfg.EpsilonMin, fmt.Sprintf("must be between 0 and epsilon (%.3f)", cfg.Epsilon))
+		}
+		v.nonNegative("epsilonDecay", cfg.EpsilonDecay)
+		v.schedule("epsilonSchedule", cfg.EpsilonSchedule, true)
+	}
+	v.positiveUnit("alpha", cfg.Alpha)
+	v.nonNegative("softmaxTemperature", cfg.SoftmaxTemperature)
+	temperature := cfg.SoftmaxTemperature
+	if temperature == 0 {
+		temperature = 1
+	}
+	if cfg.SoftmaxMinTemperature < 0 || cfg.SoftmaxMinTemperature > temperature {
+		v.fail("softmaxMinTemperature", cfg.SoftmaxMinTemperature, fmt.Sprintf("must be between 0 and softmaxTemperature (%.3f)", temperature))
+	}
+	switch cfg.Exploration {
+	case "", ExplorationEpsilonGreedy, ExplorationSoftmax, ExplorationUCB:
+	default:
+		v.fail("exploration", cfg.Exploration, "must be epsilon-greedy, softmax or ucb")
+	}
+	v.nonNegative("softmaxDecay", cfg.SoftmaxDecay)
+	v.nonNegative("ucbConstant", cfg.UCBConstant)
+	v.nonNegative("countBonus", cfg.CountBonus)
+	v.schedule("alphaSchedule", cfg.AlphaSchedule, true)
+	v.schedule("temperatureSchedule", cfg.TemperatureSchedule, false)
+	v.unit("lambda", cfg.Lambda)
+	v.nonNegativeInt("nSteps", cfg.NSteps)
+	v.nonNegativeInt("planningSteps", cfg.PlanningSteps)
+	v.nonNegative("dynaKappa", cfg.DynaKappa)
+	v.nonNegativeInt("evalEvery", cfg.EvalEvery)
+	v.nonNegativeInt("evalEpisodes", cfg.EvalEpisodes)
+	switch cfg.SnapshotPolicy {
+	case "", SnapshotEverySteps, SnapshotEpisodeEnd, SnapshotTimed:
+	default:
+		v.fail("snapshotPolicy", cfg.SnapshotPolicy, "must be steps, episode or timed")
+	}
+	v.nonNegativeInt("snapshotEvery", cfg.SnapshotEvery)
+	v.nonNegativeInt("snapshotIntervalMs", cfg.SnapshotIntervalMs)
+}
+
+// NewTrainerStrict is NewTrainer for configurations that must be used as given: it returns cfg's
+// ValidationError instead of silently normalizing bad values.
+func NewTrainerStrict(cfg Config) (*Trainer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return NewTrainer(cfg), nil
+}
+
+type validator struct {
+	fields []*FieldError
+}
+
+func (v *validator) fail(field string, value any, reason string) {
+	v.fields = append(v.fields, &FieldError{Field: field, Value: value, Reason: reason})
+}
+
+func (v *validator) nonNegative(field string, value float64) {
+	if value < 0 {
+		v.fail(field, value, "must be non-negative")
+	}
+}
+
+func (v *validator) nonNegativeInt(field string, value int) {
+	if value < 0 {
+		v.fail(field, value, "must be non-negative")
+	}
+}
+
+func (v *validator) unit(field string, value float64) {
+	if value < 0 || value > 1 {
+		v.fail(field, value, "must be between 0 and 1")
+	}
+}
+
+func (v *validator) positiveUnit(field string, value float64) {
+	if value <= 0 || value > 1 {
+		v.fail(field, value, "must be above 0 and at most 1")
+	}
+}
+
+// schedule checks a Schedule; unitFinal bounds its Final by 1 for rates such as epsilon and alpha.
+func (v *validator) schedule(field string, s Schedule, unitFinal bool) {
+	if !validScheduleKind(s.Kind) {
+		v.fail(field+".kind", s.Kind, "must be constant, linear, exponential, step, cosine or inverse")
+	}
+	if unitFinal {
+		v.unit(field+".final", s.Final)
+	} else {
+		v.nonNegative(field+".final", s.Final)
+	}
+	v.nonNegative(field+".decay", s.Decay)
+	v.nonNegativeInt(field+".episodes", s.Episodes)
+}
+
+func (v *validator) onBoard(field string, pos Position, rows, cols int) {
+	if pos.Row < 0 || pos.Row >= rows || pos.Col < 0 || pos.Col >= cols {
+		v.fail(field, fmt.Sprintf("%d,%d", pos.Row, pos.Col), fmt.Sprintf("must lie on the %dx%d board", rows, cols))
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
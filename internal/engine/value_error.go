@@ -0,0 +1,78 @@
+package engine
+
+import "math"
+
+// ValueError compares a learned Q-table against the optimal Q* of the current board.
+type ValueError struct {
+	RMSE            float64
+	MaxError        float64
+	PolicyAgreement float64
+}
+
+// refreshOptimal re-solves the board so value errors track the current goals and walls.
+// Tracking is silently disabled when the board is too large for the exact solver.
+func (t *Trainer) refreshOptimal() {
+	if !t.cfg.TrackValueError || t.grid == nil {
+		return
+	}
+	solution, err := solveEnv(t.grid, t.cfg.Gamma, t.shaper, SolverValueIteration)
+	if err != nil {
+		t.optimal = nil
+		return
+	}
+	t.optimal = solution
+}
+
+func (t *Trainer) valueError() *ValueError {
+	if t.optimal == nil || t.qvalues == nil {
+		return nil
+	}
+	var (
+		sumSquares float64
+		maxError   float64
+		pairs      int
+		states     int
+		agreements int
+	)
+	for r := 0; r < t.grid.rows; r++ {
+		for c := 0; c < t.grid.cols; c++ {
+			if t.grid.tileAt(r, c).kind == tileWall || t.isInitialGoal(r, c) {
+				continue
+			}
+			state := t.grid.stateAt(r, c)
+			optimal := t.optimal.QValues[r][c]
+			best := math.Inf(-1)
+			for a := 0; a < t.qvalues.actions; a++ {
+				diff := math.Abs(t.qvalues.get(state, a) - optimal[a])
+				sumSquares += diff * diff
+				maxError = math.Max(maxError, diff)
+				best = math.Max(best, optimal[a])
+				pairs++
+			}
+			states++
+			// Ties in Q* mean several greedy actions are optimal; any of them counts as agreement.
+			if optimal[t.qvalues.argmax(state)] >= best-1e-9 {
+				agreements++
+			}
+		}
+	}
+	if pairs == 0 {
+		return nil
+	}
+	return &ValueError{
+		RMSE:            math.Sqrt(sumSquares / float64(pairs)),
+		MaxError:        maxError,
+		PolicyAgreement: 100 * float64(agreements) / float64(states),
+	}
+}
+
+// isInitialGoal reports cells holding a goal at episode start. Entering them collects the goal, so their
+// own Q-values are never learned and would only inflate the error.
+func (t *Trainer) isInitialGoal(row, col int) bool {
+	for _, goal := range t.grid.initialGoals {
+		if goal.Row == row && goal.Col == col {
+			return true
+		}
+	}
+	return false
+}
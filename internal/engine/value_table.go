@@ -1,7 +1,5 @@
 package engine
 
-import "fmt"
-
 type valueTable struct {
 	rows     int
 	cols     int
@@ -63,16 +61,6 @@ func (v *valueTable) cloneData() [][]float64 {
 	return copyData
 }
 
-func (v *valueTable) print() {
-	fmt.Println("value table:")
-	for r := 0; r < v.rows; r++ {
-		for c := 0; c < v.cols; c++ {
-			fmt.Printf("%6.2f ", v.data[r][c])
-		}
-		fmt.Println()
-	}
-}
-
 func (v *valueTable) flatIndex(row, feature int) int {
 	if row < 0 {
 		row = 0
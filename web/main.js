@@ -108,7 +108,7 @@ function updateSliderOutput(input) {
   if (!output) return;
   const value = Number(input.value);
   let formatted;
-  if (input.name === 'epsilon' || input.name === 'alpha' || input.name === 'gamma') {
+  if (input.name === 'epsilon' || input.name === 'alpha' || input.name === 'gamma' || input.name === 'shapingScale' || input.name === 'softmaxTemperature') {
     formatted = value.toFixed(2);
   } else if (input.name === 'stepPenalty') {
     formatted = value.toFixed(3);
@@ -410,7 +410,10 @@ function processSnapshotQueue() {
     isAnimating = false;
     return;
   }
-  const snapshot = snapshotQueue.shift();
+  let snapshot = snapshotQueue.shift();
+  if (snapshot.status === 'step') {
+    snapshot = mergeStepEvent(snapshot);
+  }
   updateView(snapshot);
   if (snapshot.status === 'running') {
     if (snapshot.episode !== lastEpisodeId) {
@@ -430,6 +433,15 @@ function processSnapshotQueue() {
   }
 }
 
+// mergeStepEvent fills a lightweight step event (position and counters only) from the last full snapshot
+// so it can be drawn like a running snapshot.
+function mergeStepEvent(event) {
+  if (!lastSnapshot) {
+    return { ...createPlaceholderSnapshot(), ...event, config: {}, status: 'running' };
+  }
+  return { ...lastSnapshot, ...event, status: 'running' };
+}
+
 function updateView(snapshot) {
   lastSnapshot = snapshot;
   hideWasmRetryButton();
@@ -559,8 +571,14 @@ function renderMetrics(snapshot, context) {
   const avgSteps = completed > 0 ? snapshot.totalSteps / completed : 0;
   const successRate = completed > 0 ? snapshot.successCount / completed : 0;
   const rolling = context.rolling;
-  const epsilonDecayDisplay = typeof snapshot.config.epsilonDecay === 'number'
-    ? snapshot.config.epsilonDecay.toFixed(3)
+  let explorationDisplay = { value: `ε=${(snapshot.epsilon || 0).toFixed(2)}`, sub: 'ε-greedy' };
+  if (snapshot.config.exploration === 'softmax') {
+    explorationDisplay = { value: `τ=${(snapshot.temperature || 0).toFixed(2)}`, sub: 'softmax' };
+  } else if (snapshot.config.exploration === 'ucb') {
+    explorationDisplay = { value: `c=${(snapshot.config.ucbConstant || 0).toFixed(2)}`, sub: 'UCB1' };
+  }
+  const epsilonScheduleDisplay = typeof snapshot.config.epsilonSchedule === 'string'
+    ? snapshot.config.epsilonSchedule.split(',')[0]
     : '--';
 
   const rollingPills = rolling
@@ -588,7 +606,7 @@ function renderMetrics(snapshot, context) {
       <div class="metric-card">
         <span class="metric-label">Reward</span>
         <span class="metric-value">${snapshot.episodeReward.toFixed(2)}</span>
-        <span class="metric-sub">avg ${avgReward.toFixed(2)}</span>
+        <span class="metric-sub">avg ${avgReward.toFixed(2)} · shaping ${(snapshot.episodeShaping || 0).toFixed(2)}</span>
       </div>
       <div class="metric-card">
         <span class="metric-label">Success</span>
@@ -618,7 +636,12 @@ function renderMetrics(snapshot, context) {
       <div class="metric-card">
         <span class="metric-label">Delay</span>
         <span class="metric-value">${context.delayLabel}</span>
-        <span class="metric-sub">Eps decay ${epsilonDecayDisplay}</span>
+        <span class="metric-sub">ε ${epsilonScheduleDisplay} · α=${(snapshot.alpha || 0).toFixed(3)}</span>
+      </div>
+      <div class="metric-card">
+        <span class="metric-label">Exploration</span>
+        <span class="metric-value">${explorationDisplay.value}</span>
+        <span class="metric-sub">${explorationDisplay.sub}</span>
       </div>
     </div>
     ${rollingPills ? `<div class="metric-rolling">${rollingPills}</div>` : ''}
@@ -639,6 +662,13 @@ function appendLog(snapshot) {
       text: `Episode ${snapshot.episode}: reward ${snapshot.episodeReward.toFixed(2)} steps ${snapshot.episodeSteps}`,
     });
   }
+  if (snapshot.status === 'evaluation' && snapshot.evaluation) {
+    const evaluation = snapshot.evaluation;
+    logEntries.unshift({
+      type: 'evaluation',
+      text: `Greedy eval after episode ${snapshot.episode}: return ${evaluation.meanReturn.toFixed(2)} ± ${evaluation.returnCI.toFixed(2)}, success ${(evaluation.successRate * 100).toFixed(0)}%`,
+    });
+  }
   if (snapshot.status === 'done') {
     logEntries.unshift({
       type: 'done',
@@ -690,6 +720,8 @@ function formatStatus(snapshot) {
       return `Running episode ${snapshot.episode}`;
     case 'episode_complete':
       return `Episode ${snapshot.episode} complete`;
+    case 'evaluation':
+      return `Evaluating greedy policy after episode ${snapshot.episode}`;
     case 'done':
       return 'Training complete';
     case 'cancelled':
@@ -847,19 +879,38 @@ function heatColor(t) {
   return `rgba(${r}, ${g}, 80, 0.8)`;
 }
 
+// formSchedule builds a schedule from one of the form's selects; decay and episodes use the engine
+// defaults (0.998 per episode, the whole run) so every kind ends near the same floor.
+function formSchedule(data, name, fallback, final) {
+  return { kind: String(data.get(name) || fallback), final, decay: 0.998, episodes: 0 };
+}
+
 function serializeForm(form) {
   const data = new FormData(form);
   return {
     episodes: Number(data.get('episodes')),
     seed: Number(data.get('seed')),
     epsilon: Number(data.get('epsilon')),
-    epsilonMin: 0.05,
-    epsilonDecay: 0.998,
+    epsilonSchedule: formSchedule(data, 'epsilonSchedule', 'exponential', Math.min(0.05, Number(data.get('epsilon')))),
+    exploration: String(data.get('exploration') || 'epsilon-greedy'),
+    softmaxTemperature: Number(data.get('softmaxTemperature')),
+    temperatureSchedule: formSchedule(
+      data,
+      'temperatureSchedule',
+      'exponential',
+      Math.min(0.05, Number(data.get('softmaxTemperature')))
+    ),
     alpha: Number(data.get('alpha')),
+    alphaSchedule: formSchedule(data, 'alphaSchedule', 'constant', Math.min(0.01, Number(data.get('alpha')))),
     gamma: Number(data.get('gamma')),
+    shaping: String(data.get('shaping') || 'distance'),
+    shapingScale: Number(data.get('shapingScale')),
     rows: state.rows,
     cols: state.cols,
     algorithm: String(data.get('algorithm') || 'montecarlo'),
+    everyVisit: data.get('monteCarloVisits') === 'every',
+    importanceSampling: String(data.get('importanceSampling') || 'weighted'),
+    nSteps: Number(data.get('nSteps')),
     stepDelayMs: Number(data.get('stepDelayMs')),
     stepPenalty: Number(data.get('stepPenalty')),
     goalCount: state.goalCount,
@@ -890,7 +941,12 @@ function attachEventListeners() {
     console.log('[form] submitted config', cfg, 'playbackDelay', playbackDelayMs);
     const config = JSON.stringify(cfg);
     resetAnimationState();
-    window.tinyrlStartTraining(config);
+    const rejected = window.tinyrlStartTraining(config);
+    if (rejected && rejected.error) {
+      console.warn('[form] config rejected', rejected.fields);
+      setStatus(rejected.error);
+      return;
+    }
     hideWasmRetryButton();
     setStatus('Training...');
     setStartButtonEnabled(false);